@@ -16,11 +16,12 @@ func main() {
 
 	mux := http.NewServeMux()
 
-	// Register statsviz handlers and 3 addition user plots.
+	// Register statsviz handlers and 4 addition user plots.
 	if err := statsviz.Register(mux,
 		statsviz.TimeseriesPlot(scatterPlot()),
 		statsviz.TimeseriesPlot(barPlot()),
 		statsviz.TimeseriesPlot(stackedPlot()),
+		statsviz.HeatmapPlot(heatmapPlot()),
 	); err != nil {
 		log.Fatal(err)
 	}
@@ -121,6 +122,27 @@ InfoText field (this) accepts any HTML tags like <b>bold</b>, <i>italic</i>, etc
 	return plot
 }
 
+func heatmapPlot() statsviz.Heatmap {
+	// Build a heatmap plot, showing the distribution of request durations,
+	// from 1ms to 10s.
+	plot, err := statsviz.HeatmapPlotConfig{
+		Name:       "request-durations",
+		Title:      "Request durations",
+		InfoText:   `This is an example of a 'heatmap' plot, showing how an histogram evolves over time.`,
+		YAxisTitle: "duration",
+		Buckets:    durationBuckets,
+		Unit:       statsviz.HeatmapUnitDuration,
+		BucketName: "duration",
+		CountName:  "requests",
+		GetValue:   requestDurations,
+	}.Build()
+	if err != nil {
+		log.Fatalf("failed to build heatmap plot: %v", err)
+	}
+
+	return plot
+}
+
 var val = 0.
 
 func updateSine() float64 {
@@ -135,3 +157,21 @@ func logins() float64 {
 func signins() float64 {
 	return (rand.Float64() + 1.5) * 100
 }
+
+// Exponential buckets boundaries, in seconds.
+var durationBuckets = []float64{0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10}
+
+func requestDurations() []uint64 {
+	counts := make([]uint64, len(durationBuckets)-1)
+	for range 1000 {
+		// Log-normal distribution centered around 50ms.
+		d := math.Exp(rand.NormFloat64() - 3)
+		for i := range counts {
+			if d < durationBuckets[i+1] {
+				counts[i]++
+				break
+			}
+		}
+	}
+	return counts
+}
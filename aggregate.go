@@ -0,0 +1,405 @@
+package statsviz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// Aggregate configures the server to show, in a single dashboard, the metrics
+// of multiple remote Go programs running Statsviz, rather than those of the
+// current program.
+//
+// Each source is the URL of the websocket endpoint of a remote Statsviz
+// server, for example "ws://host:8080/debug/statsviz/ws", optionally prefixed
+// with the name to give to that source, as in "name=ws://host:port/path". By
+// default, the source name is the URL host. User credentials in the URL are
+// sent using basic authentication.
+//
+// The server connects to all sources upon creation and merges their plots:
+// the time series of a same plot are overlaid, each with the source name as
+// prefix, while heatmaps are shown once per source. When a source connection
+// is lost, the server tries to reconnect and shows zero values in the
+// meantime. Garbage collection events shown on overlaid plots are those of the
+// first source.
+func Aggregate(sources ...string) Option {
+	return func(s *Server) error {
+		for _, src := range sources {
+			name, rawURL, ok := strings.Cut(src, "=")
+			if !ok || strings.Contains(name, "/") {
+				name, rawURL = "", src
+			}
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return fmt.Errorf("invalid source %q: %v", src, err)
+			}
+			if u.Scheme != "ws" && u.Scheme != "wss" {
+				return fmt.Errorf("invalid source %q: scheme must be ws or wss", src)
+			}
+			if name == "" {
+				name = u.Host
+			}
+			s.sources = append(s.sources, &aggsource{name: name, url: u.String()})
+		}
+		return nil
+	}
+}
+
+// aggsource is a remote Statsviz server.
+type aggsource struct {
+	name string
+	url  string
+	ws   *websocket.Conn // initial connection
+	cfg  aggconfig       // configuration received at the initial connection
+
+	mu     sync.Mutex
+	last   map[string][]float64 // last received values of each series
+	events map[string][]float64 // events received since the last collection
+}
+
+// aggconfig is a plots configuration, as sent by a remote Statsviz server.
+type aggconfig struct {
+	Series []json.RawMessage `json:"series"`
+	Events []string          `json:"events"`
+}
+
+// decodeLayout decodes a plot layout, returning either a plot.Scatter or a
+// plot.Heatmap.
+func decodeLayout(raw json.RawMessage) (name string, layout any, err error) {
+	var typ struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &typ); err != nil {
+		return "", nil, err
+	}
+	if typ.Type == "heatmap" {
+		var hm plot.Heatmap
+		err = json.Unmarshal(raw, &hm)
+		return typ.Name, hm, err
+	}
+	var sc plot.Scatter
+	err = json.Unmarshal(raw, &sc)
+	return typ.Name, sc, err
+}
+
+// aggregator merges metrics received from multiple remote Statsviz servers.
+type aggregator struct {
+	sources []*aggsource
+	cfg     *plot.Config
+	series  []aggseries // how to build each series of the merged configuration
+}
+
+// aggseries describes how a series of the merged configuration is built from
+// the series of the sources.
+type aggseries struct {
+	name  string
+	event bool // events time series
+	parts []aggpart
+}
+
+// aggpart is the contribution of a source to a merged series.
+type aggpart struct {
+	src  *aggsource
+	name string // series name on the source
+	dims int    // number of values
+}
+
+func (a *aggregator) dial(ctx context.Context, src *aggsource) (*websocket.Conn, *aggconfig, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, src.url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("source %s: %v", src.name, err)
+	}
+
+	var msg struct {
+		Event string    `json:"event"`
+		Data  aggconfig `json:"data"`
+	}
+	if err := ws.ReadJSON(&msg); err != nil || msg.Event != "config" {
+		ws.Close()
+		return nil, nil, fmt.Errorf("source %s: failed to read config: %v", src.name, err)
+	}
+	return ws, &msg.Data, nil
+}
+
+// newAggregator connects to all sources and merges their configurations.
+func newAggregator(sources []*aggsource) (*aggregator, error) {
+	a := &aggregator{sources: sources}
+
+	for _, src := range sources {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ws, cfg, err := a.dial(ctx, src)
+		cancel()
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		src.ws = ws
+		src.cfg = *cfg
+	}
+
+	if err := a.merge(); err != nil {
+		a.close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// start starts receiving metrics from all sources, until ctx is canceled.
+func (a *aggregator) start(ctx context.Context) {
+	for _, src := range a.sources {
+		go a.receive(ctx, src, src.ws)
+	}
+}
+
+// close closes the initial connections to all sources, when the aggregator
+// is not started.
+func (a *aggregator) close() {
+	for _, src := range a.sources {
+		if src.ws != nil {
+			src.ws.Close()
+		}
+	}
+}
+
+// merge builds the merged configuration.
+func (a *aggregator) merge() error {
+	type srclayout struct {
+		src    *aggsource
+		layout any
+	}
+
+	// Gather layouts by plot name, in order of first appearance.
+	var names []string
+	layouts := make(map[string][]srclayout)
+	for _, src := range a.sources {
+		for _, raw := range src.cfg.Series {
+			name, layout, err := decodeLayout(raw)
+			if err != nil {
+				return fmt.Errorf("source %s: malformed plot config: %v", src.name, err)
+			}
+			if _, ok := layouts[name]; !ok {
+				names = append(names, name)
+			}
+			layouts[name] = append(layouts[name], srclayout{src, layout})
+		}
+	}
+
+	a.cfg = &plot.Config{Series: []any{}, Events: []string{}}
+	for _, src := range a.sources {
+		for _, evt := range src.cfg.Events {
+			name := evt + "@" + src.name
+			a.cfg.Events = append(a.cfg.Events, name)
+			a.series = append(a.series, aggseries{
+				name:  name,
+				event: true,
+				parts: []aggpart{{src: src, name: evt}},
+			})
+		}
+	}
+
+	eventsOf := func(evt string, src *aggsource) string {
+		if evt == "" {
+			return ""
+		}
+		return evt + "@" + src.name
+	}
+
+	for _, name := range names {
+		switch first := layouts[name][0]; first.layout.(type) {
+		case plot.Heatmap:
+			// One heatmap per source.
+			for _, sl := range layouts[name] {
+				hm, ok := sl.layout.(plot.Heatmap)
+				if !ok {
+					continue
+				}
+				hm.Name = name + "@" + sl.src.name
+				hm.Title = fmt.Sprintf("%s (%s)", hm.Title, sl.src.name)
+				hm.Events = eventsOf(hm.Events, sl.src)
+				hm.Interval = 0 // merged plots are all collected at once
+				a.cfg.Series = append(a.cfg.Series, hm)
+				a.series = append(a.series, aggseries{
+					name:  hm.Name,
+					parts: []aggpart{{src: sl.src, name: name, dims: len(hm.Buckets)}},
+				})
+			}
+
+		case plot.Scatter:
+			// Overlay the subplots of all sources.
+			merged := first.layout.(plot.Scatter)
+			merged.Subplots = nil
+			merged.Events = eventsOf(merged.Events, first.src)
+			merged.Interval = 0 // merged plots are all collected at once
+			series := aggseries{name: name}
+
+			for _, sl := range layouts[name] {
+				sc, ok := sl.layout.(plot.Scatter)
+				if !ok {
+					continue
+				}
+				for _, sp := range sc.Subplots {
+					sp.Name = sl.src.name + ": " + sp.Name
+					sp.Color = "" // let the user interface pick distinct colors
+					if sp.StackGroup != "" {
+						sp.StackGroup += "@" + sl.src.name
+					}
+					merged.Subplots = append(merged.Subplots, sp)
+				}
+				series.parts = append(series.parts, aggpart{src: sl.src, name: name, dims: len(sc.Subplots)})
+			}
+			a.cfg.Series = append(a.cfg.Series, merged)
+			a.series = append(a.series, series)
+		}
+	}
+	return nil
+}
+
+// receive receives metrics from src, reconnecting if necessary, until ctx is
+// canceled. ws is the already established connection.
+func (a *aggregator) receive(ctx context.Context, src *aggsource, ws *websocket.Conn) {
+	const (
+		minBackoff = time.Second
+		maxBackoff = 30 * time.Second
+	)
+	backoff := minBackoff
+
+	for {
+		if ws != nil {
+			backoff = minBackoff
+			a.read(ctx, src, ws)
+		}
+
+		src.mu.Lock()
+		src.last = nil
+		src.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+
+		var err error
+		if ws, _, err = a.dial(ctx, src); err != nil {
+			dbglog("failed to reconnect: %v", err)
+		}
+	}
+}
+
+// read reads metrics messages from ws until the connection is lost or ctx is
+// canceled.
+func (a *aggregator) read(ctx context.Context, src *aggsource, ws *websocket.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		ws.Close()
+	}()
+
+	for {
+		var msg struct {
+			Event string `json:"event"`
+			Data  struct {
+				Series map[string][]float64 `json:"series"`
+			} `json:"data"`
+		}
+		if err := ws.ReadJSON(&msg); err != nil {
+			dbglog("source %s: %v", src.name, err)
+			return
+		}
+		if msg.Event != "metrics" {
+			continue
+		}
+		src.update(msg.Data.Series)
+	}
+}
+
+// maxAggEvents is the maximum number of events of each series kept by a
+// source between two collections, as many garbage collections as the runtime
+// keeps in its pause history.
+const maxAggEvents = 256
+
+// update updates the last values of src with the series of a metrics message.
+func (src *aggsource) update(series map[string][]float64) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	// Sources only send the plots due for collection. The map of last values
+	// is replaced, rather than updated, since it's read by Collect without
+	// holding the lock.
+	last := maps.Clone(src.last)
+	if last == nil {
+		last = make(map[string][]float64, len(series))
+	}
+	maps.Copy(last, series)
+	src.last = last
+
+	// Collect isn't called while no user interface is connected, only the
+	// most recent events are kept meanwhile. Events are pairs of values.
+	if src.events == nil {
+		src.events = make(map[string][]float64)
+	}
+	for _, evt := range src.cfg.Events {
+		events := append(src.events[evt], series[evt]...)
+		if len(events) > 2*maxAggEvents {
+			events = events[len(events)-2*maxAggEvents:]
+		}
+		src.events[evt] = events
+	}
+}
+
+// Config returns the merged configuration.
+func (a *aggregator) Config() *plot.Config {
+	return a.cfg
+}
+
+// Collect returns the last values received from all sources, merged, of the
+// plots in the given set, or all of them if it's nil, and the events received
+// since the last call.
+func (a *aggregator) Collect(plots map[string]bool) *plot.Frame {
+	lasts := make(map[*aggsource]map[string][]float64, len(a.sources))
+	events := make(map[*aggsource]map[string][]float64, len(a.sources))
+	for _, src := range a.sources {
+		src.mu.Lock()
+		lasts[src] = src.last
+		events[src] = src.events
+		src.events = nil
+		src.mu.Unlock()
+	}
+
+	series := make(map[string][]float64, len(a.series))
+	for _, s := range a.series {
+		if !s.event && plots != nil && !plots[s.name] {
+			continue
+		}
+		vals := []float64{}
+		for _, part := range s.parts {
+			if s.event {
+				vals = append(vals, events[part.src][part.name]...)
+				continue
+			}
+			v := lasts[part.src][part.name]
+			if len(v) != part.dims {
+				v = make([]float64, part.dims)
+			}
+			vals = append(vals, v...)
+		}
+		series[s.name] = vals
+	}
+
+	return &plot.Frame{Time: time.Now(), Series: series}
+}
@@ -0,0 +1,251 @@
+package statsviz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// startRemote starts a Statsviz server and returns the URL of its websocket
+// endpoint.
+func startRemote(t *testing.T, opts ...Option) string {
+	t.Helper()
+
+	srv := newServer(t, opts...)
+	t.Cleanup(func() { srv.Close() })
+
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/debug/statsviz/ws"
+}
+
+func TestAggregate(t *testing.T) {
+	t.Parallel()
+
+	url1 := startRemote(t, SendFrequency(10*time.Millisecond))
+	url2 := startRemote(t, SendFrequency(10*time.Millisecond))
+
+	srv := newServer(t, Aggregate("a="+url1, "b="+url2), SendFrequency(10*time.Millisecond))
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var cfg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Series []struct {
+				Name     string `json:"name"`
+				Type     string `json:"type"`
+				Events   string `json:"events"`
+				Subplots []struct {
+					Name string `json:"name"`
+				} `json:"subplots"`
+			} `json:"series"`
+			Events []string `json:"events"`
+		} `json:"data"`
+	}
+	if err := ws.ReadJSON(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"lastgc@a", "lastgc@b"}; !slices.Equal(cfg.Data.Events, want) {
+		t.Errorf("events = %q, want %q", cfg.Data.Events, want)
+	}
+
+	var names []string
+	for _, s := range cfg.Data.Series {
+		names = append(names, s.Name)
+		if s.Name == "cgo" {
+			if len(s.Subplots) != 2 || !strings.HasPrefix(s.Subplots[0].Name, "a: ") || !strings.HasPrefix(s.Subplots[1].Name, "b: ") {
+				t.Errorf("cgo subplots = %v, want 1 subplot per source", s.Subplots)
+			}
+		}
+		if s.Name == "live-bytes" && s.Events != "lastgc@a" {
+			t.Errorf("live-bytes events = %q, want %q", s.Events, "lastgc@a")
+		}
+	}
+	for _, want := range []string{"cgo", "size-classes@a", "size-classes@b"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("plot %q not found in merged config %q", want, names)
+		}
+	}
+
+	// Wait for values from both sources.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var msg struct {
+			Data struct {
+				Series map[string][]float64 `json:"series"`
+			} `json:"data"`
+		}
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+
+		cgo, sca, scb := msg.Data.Series["cgo"], msg.Data.Series["size-classes@a"], msg.Data.Series["size-classes@b"]
+		if len(cgo) != 2 {
+			t.Fatalf("len(cgo) = %d, want 2", len(cgo))
+		}
+		if len(sca) <= 1 || len(sca) != len(scb) {
+			t.Fatalf("len(size-classes@a) = %d, len(size-classes@b) = %d, want same length > 1", len(sca), len(scb))
+		}
+		var total float64
+		for _, v := range scb {
+			total += v
+		}
+		if total > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("didn't receive values from source b")
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	t.Parallel()
+
+	remote := startRemote(t)
+
+	tests := map[string][]Option{
+		"bad scheme":   {Aggregate("http://localhost/debug/statsviz/ws")},
+		"bad url":      {Aggregate("ws://local host:port")},
+		"unreachable":  {Aggregate("ws://127.0.0.1:1/debug/statsviz/ws")},
+		"not statsviz": {Aggregate(strings.TrimSuffix(remote, "/ws") + "/notfound")},
+		"user plots":   {Aggregate(remote), TimeseriesPlot(TimeSeriesPlot{})},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewServer(opts...); err == nil {
+				t.Errorf("NewServer() should have errored")
+			}
+		})
+	}
+}
+
+func TestAggregatorMerge(t *testing.T) {
+	layout := func(v any) json.RawMessage {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	a := &aggregator{sources: []*aggsource{
+		{name: "x", cfg: aggconfig{
+			Series: []json.RawMessage{
+				layout(plot.Scatter{Name: "s1", Type: "scatter", Events: "lastgc", Subplots: []plot.Subplot{{Name: "v", Color: "red", StackGroup: "one"}}}),
+				layout(plot.Heatmap{Name: "h", Type: "heatmap", Title: "H", Buckets: []float64{0, 1, 2}}),
+			},
+			Events: []string{"lastgc"},
+		}},
+		{name: "y", cfg: aggconfig{
+			Series: []json.RawMessage{
+				layout(plot.Heatmap{Name: "h", Type: "heatmap", Title: "H", Buckets: []float64{0, 1, 2}}),
+				layout(plot.Scatter{Name: "s1", Type: "bar", Subplots: []plot.Subplot{{Name: "v"}, {Name: "w"}}}),
+				layout(plot.Scatter{Name: "s2", Type: "scatter", Subplots: []plot.Subplot{{Name: "z"}}}),
+			},
+			Events: []string{"lastgc"},
+		}},
+	}}
+	if err := a.merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, l := range a.cfg.Series {
+		switch l := l.(type) {
+		case plot.Scatter:
+			names = append(names, l.Name)
+		case plot.Heatmap:
+			names = append(names, l.Name)
+		}
+	}
+	if want := []string{"s1", "h@x", "h@y", "s2"}; !slices.Equal(names, want) {
+		t.Errorf("merged plots = %q, want %q", names, want)
+	}
+
+	s1 := a.cfg.Series[0].(plot.Scatter)
+	want := []plot.Subplot{
+		{Name: "x: v", StackGroup: "one@x"},
+		{Name: "y: v"},
+		{Name: "y: w"},
+	}
+	if !slices.Equal(s1.Subplots, want) {
+		t.Errorf("s1 subplots = %+v, want %+v", s1.Subplots, want)
+	}
+	if s1.Events != "lastgc@x" {
+		t.Errorf("s1 events = %q, want %q", s1.Events, "lastgc@x")
+	}
+	if hm := a.cfg.Series[1].(plot.Heatmap); hm.Title != "H (x)" {
+		t.Errorf("h@x title = %q, want %q", hm.Title, "H (x)")
+	}
+
+	// Source x is connected, y isn't.
+	a.sources[0].last = map[string][]float64{
+		"lastgc": {123, 0.5},
+		"s1":     {1},
+		"h":      {1, 2, 3},
+	}
+	a.sources[0].events = map[string][]float64{
+		"lastgc": {100, 0.1, 123, 0.5},
+	}
+
+	series := a.Collect(nil).Series
+	wantSeries := map[string][]float64{
+		"lastgc@x": {100, 0.1, 123, 0.5},
+		"lastgc@y": {},
+		"s1":       {1, 0, 0},
+		"h@x":      {1, 2, 3},
+		"h@y":      {0, 0, 0},
+		"s2":       {0},
+	}
+	for name, want := range wantSeries {
+		if got := series[name]; !slices.Equal(got, want) {
+			t.Errorf("series %q = %v, want %v", name, got, want)
+		}
+	}
+
+	// Events are only sent once.
+	if got := a.Collect(nil).Series["lastgc@x"]; len(got) != 0 {
+		t.Errorf("lastgc@x = %v, want no events", got)
+	}
+}
+
+func TestAggsourceMaxEvents(t *testing.T) {
+	src := &aggsource{cfg: aggconfig{Events: []string{"lastgc"}}}
+
+	// Without collection, only the most recent events are kept.
+	for i := range 2 * maxAggEvents {
+		src.update(map[string][]float64{"lastgc": {float64(i), 0.5}, "cgo": {float64(i)}})
+	}
+	events := src.events["lastgc"]
+	if len(events) != 2*maxAggEvents {
+		t.Fatalf("len(events) = %d, want %d", len(events), 2*maxAggEvents)
+	}
+	if first, last := events[0], events[len(events)-2]; first != maxAggEvents || last != 2*maxAggEvents-1 {
+		t.Errorf("events from %v to %v, want from %v to %v", first, last, maxAggEvents, 2*maxAggEvents-1)
+	}
+	if got := src.last["cgo"]; !slices.Equal(got, []float64{2*maxAggEvents - 1}) {
+		t.Errorf("last cgo = %v, want [%d]", got, 2*maxAggEvents-1)
+	}
+}
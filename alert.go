@@ -0,0 +1,227 @@
+package statsviz
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// An AlertCondition reports whether an alert condition is met, given the
+// current values of the time series of a plot, by time series name.
+type AlertCondition func(values map[string]float64) bool
+
+// Above returns a condition met when the value of the named time series is
+// above the threshold.
+func Above(series string, threshold float64) AlertCondition {
+	return func(values map[string]float64) bool {
+		v, ok := values[series]
+		return ok && v > threshold
+	}
+}
+
+// Below returns a condition met when the value of the named time series is
+// below the threshold.
+func Below(series string, threshold float64) AlertCondition {
+	return func(values map[string]float64) bool {
+		v, ok := values[series]
+		return ok && v < threshold
+	}
+}
+
+// AboveRatio returns a condition met when the value of the named time series
+// is above the given ratio of the value of another time series of the same
+// plot. For example, the condition for the live heap exceeding 90% of the
+// memory limit, on the "garbage collection" plot, is:
+//
+//	AboveRatio("heap live", "memory limit", 0.9)
+func AboveRatio(series, of string, ratio float64) AlertCondition {
+	return func(values map[string]float64) bool {
+		v, ok1 := values[series]
+		ref, ok2 := values[of]
+		return ok1 && ok2 && ref > 0 && v > ratio*ref
+	}
+}
+
+// An AlertRule describes an alert, evaluated by the server at each metrics
+// collection against the values of a time series plot. Firing alerts are shown
+// on the user interface as colored regions over the plot.
+type AlertRule struct {
+	// Name identifies the alert. It's shown on the user interface.
+	Name string
+
+	// Plot is the name of the time series plot the condition is evaluated
+	// against, for example "goroutines", "cpu-overall" or the name of a user
+	// plot.
+	Plot string
+
+	// Condition reports whether the alert condition is met. The provided
+	// values are those of the plot time series, by name, as shown on the plot
+	// legend. See [Above], [Below] and [AboveRatio].
+	Condition AlertCondition
+
+	// For is how long the condition must be met before the alert fires. With
+	// 0, the alert fires as soon as the condition is met.
+	For time.Duration
+
+	// Color is the color of the alert regions on the user interface, as a CSS
+	// color. Defaults to a translucent red.
+	Color string
+}
+
+const defaultAlertColor = "rgba(220, 53, 69, 0.25)"
+
+// An AlertEvent is emitted when an alert starts firing or is resolved.
+type AlertEvent struct {
+	Rule AlertRule
+
+	// Firing is true when the alert starts firing, and false when it's
+	// resolved.
+	Firing bool
+
+	// Since is when the alert condition started to be met.
+	Since time.Time
+
+	// Time is when the event happened.
+	Time time.Time
+}
+
+// Alert adds an alert rule. This option can be added multiple times.
+func Alert(rule AlertRule) Option {
+	return func(s *Server) error {
+		if rule.Name == "" {
+			return fmt.Errorf("alert name can't be empty")
+		}
+		if rule.Condition == nil {
+			return fmt.Errorf("alert %q has no condition", rule.Name)
+		}
+		if rule.For < 0 {
+			return fmt.Errorf("alert %q duration must be non-negative", rule.Name)
+		}
+		if rule.Color == "" {
+			rule.Color = defaultAlertColor
+		}
+		s.alertRules = append(s.alertRules, rule)
+		return nil
+	}
+}
+
+// OnAlert sets a function called each time an alert starts firing or is
+// resolved, for example to forward alerts to a notification system. The
+// function is called from the goroutine collecting metrics, so it shouldn't
+// block.
+func OnAlert(fn func(AlertEvent)) Option {
+	return func(s *Server) error {
+		s.onAlert = fn
+		return nil
+	}
+}
+
+// maxAlertRegions is the maximum number of alert regions sent to clients.
+const maxAlertRegions = 100
+
+// alertRegion is a period during which an alert fired.
+type alertRegion struct {
+	Name  string `json:"name"`
+	Plot  string `json:"plot"`
+	Color string `json:"color"`
+	Start int64  `json:"start"`         // milliseconds
+	End   int64  `json:"end,omitempty"` // milliseconds, 0 while firing
+}
+
+// alerter evaluates alert rules. It's not safe for concurrent use.
+type alerter struct {
+	rules   []AlertRule
+	onAlert func(AlertEvent)
+
+	subplots [][]string     // names of the time series of the plot of each rule
+	since    []time.Time    // when the condition of each rule started to be met
+	firing   []*alertRegion // region of each firing rule, nil if not firing
+	regions  []*alertRegion // last regions, oldest first
+}
+
+func newAlerter(rules []AlertRule, onAlert func(AlertEvent), cfg *plot.Config) (*alerter, error) {
+	a := &alerter{
+		rules:    rules,
+		onAlert:  onAlert,
+		subplots: make([][]string, len(rules)),
+		since:    make([]time.Time, len(rules)),
+		firing:   make([]*alertRegion, len(rules)),
+	}
+
+rules:
+	for i, rule := range rules {
+		for _, layout := range cfg.Series {
+			switch layout := layout.(type) {
+			case plot.Scatter:
+				if layout.Name == rule.Plot {
+					for _, sp := range layout.Subplots {
+						a.subplots[i] = append(a.subplots[i], sp.Name)
+					}
+					continue rules
+				}
+			case plot.Heatmap:
+				if layout.Name == rule.Plot {
+					return nil, fmt.Errorf("alert %q: %q is not a time series plot", rule.Name, rule.Plot)
+				}
+			}
+		}
+		return nil, fmt.Errorf("alert %q: unknown plot %q", rule.Name, rule.Plot)
+	}
+	return a, nil
+}
+
+// eval evaluates all rules against the values of a metrics frame. It reports
+// whether any alert started firing or has been resolved.
+func (a *alerter) eval(f *plot.Frame) bool {
+	changed := false
+	for i, rule := range a.rules {
+		vals, ok := f.Series[rule.Plot]
+		if !ok {
+			continue // not collected this time
+		}
+		values := make(map[string]float64, len(vals))
+		for j, name := range a.subplots[i] {
+			if j < len(vals) {
+				values[name] = vals[j]
+			}
+		}
+
+		if !rule.Condition(values) {
+			if r := a.firing[i]; r != nil {
+				r.End = f.Time.UnixMilli()
+				a.firing[i] = nil
+				changed = true
+				a.notify(AlertEvent{Rule: rule, Firing: false, Since: a.since[i], Time: f.Time})
+			}
+			a.since[i] = time.Time{}
+			continue
+		}
+
+		if a.since[i].IsZero() {
+			a.since[i] = f.Time
+		}
+		if a.firing[i] == nil && f.Time.Sub(a.since[i]) >= rule.For {
+			r := &alertRegion{
+				Name:  rule.Name,
+				Plot:  rule.Plot,
+				Color: rule.Color,
+				Start: a.since[i].UnixMilli(),
+			}
+			if len(a.regions) == maxAlertRegions {
+				a.regions = a.regions[1:]
+			}
+			a.regions = append(a.regions, r)
+			a.firing[i] = r
+			changed = true
+			a.notify(AlertEvent{Rule: rule, Firing: true, Since: a.since[i], Time: f.Time})
+		}
+	}
+	return changed
+}
+
+func (a *alerter) notify(evt AlertEvent) {
+	if a.onAlert != nil {
+		a.onAlert(evt)
+	}
+}
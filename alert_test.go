@@ -0,0 +1,242 @@
+package statsviz
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+func TestAlertConditions(t *testing.T) {
+	values := map[string]float64{"a": 10, "b": 20}
+
+	tests := []struct {
+		name string
+		cond AlertCondition
+		want bool
+	}{
+		{"above", Above("a", 5), true},
+		{"not above", Above("a", 10), false},
+		{"above unknown", Above("c", -1), false},
+		{"below", Below("a", 11), true},
+		{"not below", Below("a", 10), false},
+		{"below unknown", Below("c", 100), false},
+		{"above ratio", AboveRatio("a", "b", 0.4), true},
+		{"not above ratio", AboveRatio("a", "b", 0.5), false},
+		{"above ratio unknown", AboveRatio("a", "c", 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond(values); got != tt.want {
+				t.Errorf("condition = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertErrors(t *testing.T) {
+	always := func(map[string]float64) bool { return true }
+
+	tests := map[string]AlertRule{
+		"no name":        {Plot: "goroutines", Condition: always},
+		"no condition":   {Name: "alert", Plot: "goroutines"},
+		"negative for":   {Name: "alert", Plot: "goroutines", Condition: always, For: -time.Second},
+		"unknown plot":   {Name: "alert", Plot: "unknown", Condition: always},
+		"heatmap plot":   {Name: "alert", Plot: "size-classes", Condition: always},
+		"no plot at all": {Name: "alert", Condition: always},
+	}
+	for name, rule := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewServer(Alert(rule)); err == nil {
+				t.Errorf("NewServer() should have errored")
+			}
+		})
+	}
+}
+
+func TestAlerterEval(t *testing.T) {
+	cfg := &plot.Config{Series: []any{
+		plot.Scatter{Name: "plot", Subplots: []plot.Subplot{{Name: "x"}, {Name: "y"}}},
+	}}
+
+	var events []AlertEvent
+	a, err := newAlerter([]AlertRule{
+		{Name: "high y", Plot: "plot", Condition: Above("y", 10), For: 2 * time.Second, Color: "red"},
+	}, func(evt AlertEvent) { events = append(events, evt) }, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.UnixMilli(1_000_000)
+	tick := func(sec int, y float64) bool {
+		return a.eval(&plot.Frame{
+			Time:   start.Add(time.Duration(sec) * time.Second),
+			Series: map[string][]float64{"plot": {0, y}},
+		})
+	}
+
+	steps := []struct {
+		y           float64
+		wantChanged bool
+	}{
+		{y: 0},
+		{y: 20},                    // condition met since t=1
+		{y: 20},                    // not long enough
+		{y: 20, wantChanged: true}, // fires
+		{y: 20},
+		{y: 0, wantChanged: true}, // resolved
+		{y: 20},                   // condition met again since t=6
+		{y: 0},                    // but not long enough
+	}
+	for i, step := range steps {
+		if changed := tick(i, step.y); changed != step.wantChanged {
+			t.Fatalf("tick %d: changed = %t, want %t", i, changed, step.wantChanged)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d alert events, want 2", len(events))
+	}
+	if evt := events[0]; !evt.Firing || !evt.Since.Equal(start.Add(time.Second)) || !evt.Time.Equal(start.Add(3*time.Second)) {
+		t.Errorf("first event = %+v, want firing since t=1 at t=3", evt)
+	}
+	if evt := events[1]; evt.Firing || !evt.Since.Equal(start.Add(time.Second)) || !evt.Time.Equal(start.Add(5*time.Second)) {
+		t.Errorf("second event = %+v, want resolved at t=5", evt)
+	}
+
+	want := alertRegion{
+		Name:  "high y",
+		Plot:  "plot",
+		Color: "red",
+		Start: start.Add(time.Second).UnixMilli(),
+		End:   start.Add(5 * time.Second).UnixMilli(),
+	}
+	if len(a.regions) != 1 || *a.regions[0] != want {
+		t.Errorf("regions = %+v, want [%+v]", a.regions, want)
+	}
+}
+
+func TestAlerterMaxRegions(t *testing.T) {
+	cfg := &plot.Config{Series: []any{
+		plot.Scatter{Name: "plot", Subplots: []plot.Subplot{{Name: "x"}}},
+	}}
+	a, err := newAlerter([]AlertRule{{Name: "alert", Plot: "plot", Condition: Above("x", 0)}}, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.UnixMilli(1_000_000)
+	for i := range 2*maxAlertRegions + 1 {
+		a.eval(&plot.Frame{
+			Time:   start.Add(time.Duration(i) * time.Second),
+			Series: map[string][]float64{"plot": {float64(1 - i%2)}},
+		})
+	}
+
+	if len(a.regions) != maxAlertRegions {
+		t.Fatalf("len(regions) = %d, want %d", len(a.regions), maxAlertRegions)
+	}
+	if last := a.regions[len(a.regions)-1]; last.End != 0 || a.firing[0] != last {
+		t.Errorf("last region should be firing")
+	}
+}
+
+func TestAlertWs(t *testing.T) {
+	t.Parallel()
+
+	var value atomic.Int64
+	tsp, err := TimeSeriesPlotConfig{
+		Name:   "user",
+		Series: []TimeSeries{{Name: "value", GetValue: func() float64 { return float64(value.Load()) }}},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fired := make(chan AlertEvent, 1)
+	srv := newServer(t,
+		TimeseriesPlot(tsp),
+		SendFrequency(10*time.Millisecond),
+		Alert(AlertRule{Name: "too high", Plot: "user", Condition: Above("value", 100)}),
+		OnAlert(func(evt AlertEvent) { fired <- evt }),
+	)
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	type alertsMsg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Alerts []alertRegion `json:"alerts"`
+		} `json:"data"`
+	}
+
+	// readAlerts reads messages until an alerts message is received.
+	readAlerts := func(ws *websocket.Conn) []alertRegion {
+		t.Helper()
+		for {
+			var msg alertsMsg
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Event == "alerts" {
+				return msg.Data.Alerts
+			}
+		}
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	value.Store(1000)
+	select {
+	case evt := <-fired:
+		if !evt.Firing || evt.Rule.Name != "too high" {
+			t.Errorf("got alert event %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert didn't fire")
+	}
+
+	alerts := readAlerts(ws)
+	if len(alerts) != 1 || alerts[0].Name != "too high" || alerts[0].Plot != "user" || alerts[0].End != 0 {
+		t.Fatalf("got alerts %+v, want 1 firing alert", alerts)
+	}
+
+	// New clients get the alerts right after the configuration.
+	ws2, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws2.Close()
+
+	var cfg wsmsg
+	if err := ws2.ReadJSON(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	var msg alertsMsg
+	if err := ws2.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "alerts" || len(msg.Data.Alerts) != 1 {
+		t.Errorf("got %q message with %d alerts, want 1 alert", msg.Event, len(msg.Data.Alerts))
+	}
+
+	value.Store(0)
+	if evt := <-fired; evt.Firing {
+		t.Errorf("got alert event %+v, want resolved", evt)
+	}
+	if alerts := readAlerts(ws); len(alerts) != 1 || alerts[0].End == 0 {
+		t.Errorf("got alerts %+v, want 1 resolved alert", alerts)
+	}
+}
@@ -0,0 +1,129 @@
+package statsviz
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// EventStreamConfig describes a stream of events, such as deploys, config
+// reloads or incidents, emitted by the program with [Server.Annotate]. Events
+// are shown as labeled vertical lines over plots, and each stream can be
+// shown or hidden from the user interface.
+type EventStreamConfig struct {
+	// Name identifies the stream. It must be unique.
+	Name string
+
+	// Plots are the names of the plots on which events are shown. If empty,
+	// events are shown on all time series plots.
+	Plots []string
+
+	// Color is the color of the vertical lines, as a CSS color. Defaults to
+	// orange.
+	Color string
+}
+
+const defaultEventColor = "rgb(255, 127, 14)"
+
+// EventStream adds a stream of events. This option can be added multiple
+// times.
+func EventStream(cfg EventStreamConfig) Option {
+	return func(s *Server) error {
+		if cfg.Name == "" {
+			return fmt.Errorf("event stream name can't be empty")
+		}
+		if slices.ContainsFunc(s.streams, func(es plot.EventStream) bool { return es.Name == cfg.Name }) {
+			return fmt.Errorf("duplicate event stream %q", cfg.Name)
+		}
+		if cfg.Color == "" {
+			cfg.Color = defaultEventColor
+		}
+		s.streams = append(s.streams, plot.EventStream{
+			Name:  cfg.Name,
+			Color: cfg.Color,
+			Plots: slices.Clone(cfg.Plots),
+		})
+		return nil
+	}
+}
+
+// ErrUnknownEventStream is returned by [Server.Annotate] when the event
+// stream has not been added with the [EventStream] option.
+var ErrUnknownEventStream = errors.New("unknown event stream")
+
+// withStreams returns a copy of cfg with the given event streams, after having
+// checked that their plots exist.
+func withStreams(cfg *plot.Config, streams []plot.EventStream) (*plot.Config, error) {
+	for _, es := range streams {
+		for _, name := range es.Plots {
+			if !slices.ContainsFunc(cfg.Series, func(layout any) bool { return plot.LayoutName(layout) == name }) {
+				return nil, fmt.Errorf("event stream %q: unknown plot %q", es.Name, name)
+			}
+		}
+	}
+
+	c := *cfg
+	c.Streams = streams
+	return &c, nil
+}
+
+// maxAnnotations is the maximum number of annotations sent to clients.
+const maxAnnotations = 500
+
+// annotation is an event of a stream.
+type annotation struct {
+	Stream string `json:"stream"`
+	Label  string `json:"label"`
+	Time   int64  `json:"time"` // milliseconds
+}
+
+// annotator keeps the last annotations of all event streams.
+type annotator struct {
+	mu   sync.Mutex
+	list []annotation // oldest first
+}
+
+// Annotate emits an event, with the given label, on the named event stream.
+// The event is immediately sent to all connected user interfaces, and shown
+// as a vertical line over the plots of the stream. The last 500 events are
+// also sent to newly connected user interfaces.
+//
+// Annotate is safe for concurrent use. It returns [ErrUnknownEventStream] if
+// the stream has not been added with the [EventStream] option.
+func (s *Server) Annotate(stream, label string) error {
+	if !slices.ContainsFunc(s.streams, func(es plot.EventStream) bool { return es.Name == stream }) {
+		return fmt.Errorf("%w %q", ErrUnknownEventStream, stream)
+	}
+
+	s.annotations.mu.Lock()
+	defer s.annotations.mu.Unlock()
+
+	now := time.Now()
+	if len(s.annotations.list) == maxAnnotations {
+		s.annotations.list = s.annotations.list[1:]
+	}
+	s.annotations.list = append(s.annotations.list, annotation{
+		Stream: stream,
+		Label:  label,
+		Time:   now.UnixMilli(),
+	})
+
+	msg, err := newJSONMsg("annotations", struct {
+		Annotations []annotation `json:"annotations"`
+		Timestamp   int64        `json:"timestamp"`
+	}{s.annotations.list, now.UnixMilli()})
+	if err != nil {
+		return err
+	}
+	if s.rec != nil {
+		if err := s.rec.write(append(msg, '\n')); err != nil {
+			dbglog("failed to record annotation: %v", err)
+		}
+	}
+	s.clients.publish("annotations", msg)
+	return nil
+}
@@ -0,0 +1,129 @@
+package statsviz
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEventStreamErrors(t *testing.T) {
+	tests := map[string][]Option{
+		"empty name":   {EventStream(EventStreamConfig{})},
+		"duplicate":    {EventStream(EventStreamConfig{Name: "deploy"}), EventStream(EventStreamConfig{Name: "deploy"})},
+		"unknown plot": {EventStream(EventStreamConfig{Name: "deploy", Plots: []string{"unknown"}})},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewServer(opts...); err == nil {
+				t.Errorf("NewServer() should have errored")
+			}
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	srv := newServer(t, EventStream(EventStreamConfig{Name: "deploy"}))
+	defer srv.Close()
+
+	if err := srv.Annotate("unknown", "v1"); !errors.Is(err, ErrUnknownEventStream) {
+		t.Errorf("Annotate() with unknown stream returned %v, want %v", err, ErrUnknownEventStream)
+	}
+
+	for range maxAnnotations + 10 {
+		if err := srv.Annotate("deploy", "v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(srv.annotations.list); n != maxAnnotations {
+		t.Errorf("kept %d annotations, want %d", n, maxAnnotations)
+	}
+}
+
+func TestAnnotateWs(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t,
+		SendFrequency(10*time.Millisecond),
+		EventStream(EventStreamConfig{Name: "deploy", Plots: []string{"cgo"}, Color: "green"}),
+		EventStream(EventStreamConfig{Name: "incident"}),
+	)
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	type streamsCfg struct {
+		Data struct {
+			Streams []struct {
+				Name  string   `json:"name"`
+				Color string   `json:"color"`
+				Plots []string `json:"plots"`
+			} `json:"streams"`
+		} `json:"data"`
+	}
+	type annotationsMsg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Annotations []annotation `json:"annotations"`
+		} `json:"data"`
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var cfg streamsCfg
+	if err := ws.ReadJSON(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	streams := cfg.Data.Streams
+	if len(streams) != 2 || streams[0].Name != "deploy" || streams[0].Color != "green" || streams[0].Plots[0] != "cgo" ||
+		streams[1].Name != "incident" || streams[1].Color != defaultEventColor {
+		t.Fatalf("got streams %+v", streams)
+	}
+
+	before := time.Now().UnixMilli()
+	if err := srv.Annotate("deploy", "v1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		var msg annotationsMsg
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Event != "annotations" {
+			continue
+		}
+		got := msg.Data.Annotations
+		if len(got) != 1 || got[0].Stream != "deploy" || got[0].Label != "v1.2.3" || got[0].Time < before {
+			t.Fatalf("got annotations %+v", got)
+		}
+		break
+	}
+
+	// New clients get the annotations right after the configuration.
+	ws2, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws2.Close()
+
+	if err := ws2.ReadJSON(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	var msg annotationsMsg
+	if err := ws2.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "annotations" || len(msg.Data.Annotations) != 1 {
+		t.Errorf("got %q message with %d annotations, want 1 annotation", msg.Event, len(msg.Data.Annotations))
+	}
+}
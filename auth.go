@@ -0,0 +1,105 @@
+package statsviz
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthorized can be returned by an authorization function to reject a
+// request with a 401 Unauthorized status, signaling that the request lacks
+// valid credentials. See [Authorize].
+var ErrUnauthorized = errors.New("unauthorized")
+
+// challengeError is an ErrUnauthorized carrying the authentication scheme to
+// be sent in the WWW-Authenticate response header.
+type challengeError struct {
+	challenge string
+}
+
+func (e challengeError) Error() string { return ErrUnauthorized.Error() }
+func (e challengeError) Unwrap() error { return ErrUnauthorized }
+
+// Authorize sets a function called to authorize each request made to the
+// Statsviz handlers: the user interface, the websocket, the metrics handler
+// and the export handler. A request is rejected if the function returns a non-nil error,
+// with a 401 Unauthorized status if the error is [ErrUnauthorized], or wraps
+// it, and with a 403 Forbidden status otherwise. Websocket requests are
+// rejected before the connection is upgraded.
+//
+// This option can be added multiple times, in which case all authorization
+// functions must accept the request.
+func Authorize(authorize func(r *http.Request) error) Option {
+	return func(s *Server) error {
+		if authorize == nil {
+			return errors.New("nil authorization function")
+		}
+		s.authorizers = append(s.authorizers, authorize)
+		return nil
+	}
+}
+
+// BasicAuth protects Statsviz handlers with HTTP basic authentication. Only
+// requests with the given user name and password are accepted.
+func BasicAuth(user, password string) Option {
+	return Authorize(func(r *http.Request) error {
+		u, p, ok := r.BasicAuth()
+		if !ok || !equal(u, user) || !equal(p, password) {
+			return challengeError{`Basic realm="statsviz", charset="UTF-8"`}
+		}
+		return nil
+	})
+}
+
+// BearerToken protects Statsviz handlers with a bearer token. Only requests
+// with an 'Authorization: Bearer <token>' header are accepted.
+//
+// Browsers can't set an Authorization header on the requests they make to load
+// the user interface or to open its websocket, so the user interface can't be
+// used with a bearer token. It's meant to protect the metrics and export
+// handlers, when they're used by non-browser clients, like Prometheus.
+func BearerToken(token string) Option {
+	return Authorize(func(r *http.Request) error {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) || !equal(auth[len(prefix):], token) {
+			return challengeError{`Bearer realm="statsviz"`}
+		}
+		return nil
+	})
+}
+
+// equal compares 2 strings in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorized wraps h so that requests are authorized first.
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	if len(s.authorizers) == 0 {
+		return h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, authorize := range s.authorizers {
+			err := authorize(r)
+			if err == nil {
+				continue
+			}
+
+			dbglog("rejected request to %s: %v", r.URL.Path, err)
+			status := http.StatusForbidden
+			if errors.Is(err, ErrUnauthorized) {
+				status = http.StatusUnauthorized
+				var ce challengeError
+				if errors.As(err, &ce) {
+					w.Header().Set("WWW-Authenticate", ce.challenge)
+				}
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,189 @@
+package statsviz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAuthorize(t *testing.T) {
+	errNotAdmin := errors.New("not an admin")
+	isAdmin := func(r *http.Request) error {
+		if r.Header.Get("X-Role") != "admin" {
+			return errNotAdmin
+		}
+		return nil
+	}
+	hasUser := func(r *http.Request) error {
+		if r.Header.Get("X-User") == "" {
+			return fmt.Errorf("no user: %w", ErrUnauthorized)
+		}
+		return nil
+	}
+
+	type request struct {
+		header    http.Header
+		basicAuth []string
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		req       request
+		want      int
+		challenge string
+	}{
+		{
+			name: "no auth",
+			want: http.StatusOK,
+		},
+		{
+			name: "basic ok",
+			opts: []Option{BasicAuth("user", "pwd")},
+			req:  request{basicAuth: []string{"user", "pwd"}},
+			want: http.StatusOK,
+		},
+		{
+			name:      "basic missing",
+			opts:      []Option{BasicAuth("user", "pwd")},
+			want:      http.StatusUnauthorized,
+			challenge: `Basic realm="statsviz", charset="UTF-8"`,
+		},
+		{
+			name:      "basic wrong password",
+			opts:      []Option{BasicAuth("user", "pwd")},
+			req:       request{basicAuth: []string{"user", "pwd2"}},
+			want:      http.StatusUnauthorized,
+			challenge: `Basic realm="statsviz", charset="UTF-8"`,
+		},
+		{
+			name: "bearer ok",
+			opts: []Option{BearerToken("s3cr3t")},
+			req:  request{header: http.Header{"Authorization": {"Bearer s3cr3t"}}},
+			want: http.StatusOK,
+		},
+		{
+			name: "bearer case insensitive scheme",
+			opts: []Option{BearerToken("s3cr3t")},
+			req:  request{header: http.Header{"Authorization": {"bearer s3cr3t"}}},
+			want: http.StatusOK,
+		},
+		{
+			name:      "bearer wrong token",
+			opts:      []Option{BearerToken("s3cr3t")},
+			req:       request{header: http.Header{"Authorization": {"Bearer secret"}}},
+			want:      http.StatusUnauthorized,
+			challenge: `Bearer realm="statsviz"`,
+		},
+		{
+			name: "custom forbidden",
+			opts: []Option{Authorize(isAdmin)},
+			req:  request{header: http.Header{"X-Role": {"guest"}}},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "custom unauthorized",
+			opts: []Option{Authorize(hasUser)},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "all must accept",
+			opts: []Option{Authorize(hasUser), Authorize(isAdmin)},
+			req:  request{header: http.Header{"X-User": {"bob"}}},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "all accept",
+			opts: []Option{Authorize(hasUser), Authorize(isAdmin)},
+			req:  request{header: http.Header{"X-User": {"bob"}, "X-Role": {"admin"}}},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t, tt.opts...)
+			defer srv.Close()
+
+			mux := http.NewServeMux()
+			srv.Register(mux)
+			mux.Handle("/metrics", srv.Metrics())
+
+			for _, url := range []string{
+				"http://example.com/debug/statsviz/",
+				"http://example.com/debug/statsviz/ws",
+				"http://example.com/debug/statsviz/export",
+				"http://example.com/metrics",
+			} {
+				req := httptest.NewRequest("GET", url, nil)
+				for k, v := range tt.req.header {
+					req.Header[k] = v
+				}
+				if tt.req.basicAuth != nil {
+					req.SetBasicAuth(tt.req.basicAuth[0], tt.req.basicAuth[1])
+				}
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+
+				want := tt.want
+				switch {
+				case want != http.StatusOK:
+				case url == "http://example.com/debug/statsviz/ws":
+					// Authorized, but not a websocket upgrade request.
+					want = http.StatusBadRequest
+				case url == "http://example.com/debug/statsviz/export":
+					// Authorized, but the history is disabled.
+					want = http.StatusNotFound
+				}
+				if w.Code != want {
+					t.Errorf("GET %s responded %d, want %d", url, w.Code, want)
+				}
+				if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+					t.Errorf("GET %s header[WWW-Authenticate] = %q, want %q", url, got, tt.challenge)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeNil(t *testing.T) {
+	if _, err := NewServer(Authorize(nil)); err == nil {
+		t.Errorf("NewServer() should have errored")
+	}
+}
+
+func TestAuthorizeWs(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	srv := newServer(t, BasicAuth("user", "pwd"))
+	defer srv.Close()
+	srv.Register(mux)
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	u := "ws" + s.URL[len("http"):] + "/debug/statsviz/ws"
+
+	// Rejected before upgrade.
+	_, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil {
+		t.Fatalf("websocket dial succeeded without credentials")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("websocket dial response = %v, want status %d", resp, http.StatusUnauthorized)
+	}
+
+	hdr := http.Header{}
+	req := httptest.NewRequest("GET", u, nil)
+	req.SetBasicAuth("user", "pwd")
+	hdr.Set("Authorization", req.Header.Get("Authorization"))
+	ws, _, err := websocket.DefaultDialer.Dial(u, hdr)
+	if err != nil {
+		t.Fatalf("websocket dial with credentials: %v", err)
+	}
+	ws.Close()
+}
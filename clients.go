@@ -2,7 +2,10 @@ package statsviz
 
 import (
 	"context"
+	"encoding/json"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -10,26 +13,112 @@ import (
 )
 
 type clients struct {
-	cfg *plot.Config
-	ctx context.Context
+	cfg     *plot.Config
+	ctx     context.Context
+	tick    time.Duration // interval between metrics messages
+	bufsize int           // number of metrics messages queued per client
+	running *tracker      // client goroutines, waited for on shutdown
 
-	mu sync.RWMutex
-	m  map[*websocket.Conn]chan []byte
+	mu      sync.RWMutex
+	m       map[*websocket.Conn]*client
+	hist    *history // last broadcast metrics, replayed to new clients
+	states  []state  // last published state messages, sent to all clients
+	version int      // incremented at each published state
+
+	wake chan struct{} // signaled when a client connects
+}
+
+// client is a connected websocket client.
+type client struct {
+	frames chan struct{} // signaled when frames have been queued
+	states chan struct{} // signaled when states have been published
+	cmds   chan command  // commands sent by the client
+	done   chan struct{} // closed when the client connection is closed
+	quit   chan struct{} // closed when the client goroutine returns
+
+	// Protected by clients.mu, since they decide what is collected.
+	visible map[string]bool // plots the client subscribed to, nil for all
+	paused  bool            // the client doesn't want metrics for now
+
+	// Only accessed by the client goroutine.
+	interval time.Duration // minimum interval between metrics messages
+	pending  *frame        // metrics not sent yet, because of interval
+	lastSent time.Time     // time of the last metrics sent
+
+	qmu     sync.Mutex
+	queue   []*frame // frames to send, oldest first
+	dropped int      // frames merged into others since the last report
 }
 
-func newClients(ctx context.Context, cfg *plot.Config) *clients {
+func newClients(ctx context.Context, cfg *plot.Config, histsize int, tick time.Duration, bufsize int, running *tracker) *clients {
 	return &clients{
-		m:   make(map[*websocket.Conn]chan []byte),
-		cfg: cfg,
-		ctx: ctx,
+		running: running,
+		m:       make(map[*websocket.Conn]*client),
+		cfg:     cfg,
+		ctx:     ctx,
+		tick:    tick,
+		bufsize: bufsize,
+		hist:    newHistory(histsize),
+		wake:    make(chan struct{}, 1),
 	}
 }
 
+// push queues f for sending. If the queue is full, because the client is
+// lagging behind, all queued frames are merged with f into a single frame, so
+// that the client gets the latest values as soon as it catches up.
+func (cl *client) push(f *frame, bufsize int) {
+	cl.qmu.Lock()
+	if len(cl.queue) >= bufsize {
+		for _, old := range slices.Backward(cl.queue) {
+			f = old.merge(f)
+		}
+		cl.dropped += len(cl.queue)
+		cl.queue = cl.queue[:0]
+	}
+	cl.queue = append(cl.queue, f)
+	cl.qmu.Unlock()
+
+	select {
+	case cl.frames <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the queue and returns the queued frames and the number of
+// frames dropped since the last call.
+func (cl *client) take() (frames []*frame, dropped int) {
+	cl.qmu.Lock()
+	defer cl.qmu.Unlock()
+
+	frames, dropped = cl.queue, cl.dropped
+	cl.queue, cl.dropped = nil, 0
+	return frames, dropped
+}
+
 type wsmsg struct {
 	Event string `json:"event"`
 	Data  any    `json:"data"`
 }
 
+// jsonmsg is a JSON-encoded wsmsg.
+type jsonmsg []byte
+
+func (m jsonmsg) send(conn *websocket.Conn) error {
+	return sendbuf(conn, websocket.TextMessage, m)
+}
+
+// newJSONMsg returns the JSON-encoded message for the given event and data.
+func newJSONMsg(event string, data any) (jsonmsg, error) {
+	return json.Marshal(wsmsg{Event: event, Data: data})
+}
+
+// state is the last published message of an event.
+type state struct {
+	event   string
+	version int
+	msg     jsonmsg
+}
+
 func (c *clients) add(conn *websocket.Conn) {
 	dbglog("adding client")
 
@@ -40,38 +129,159 @@ func (c *clients) add(conn *websocket.Conn) {
 		return
 	}
 
-	ch := make(chan []byte)
+	cl := &client{
+		frames: make(chan struct{}, 1),
+		states: make(chan struct{}, 1),
+		cmds:   make(chan command),
+		done:   make(chan struct{}),
+		quit:   make(chan struct{}),
+	}
 
+	// Register the client and copy the history at once, so that the client
+	// can't receive the same message twice.
+	if !c.running.start() {
+		if c.running.closing() {
+			_ = goingAway(conn)
+		}
+		conn.Close()
+		return
+	}
+	c.mu.Lock()
+	c.m[conn] = cl
+	past := c.hist.slice()
+	c.mu.Unlock()
+	c.wakeup()
+
+	go c.read(conn, cl)
 	go func() {
+		var closeErr error
 		defer func() {
+			close(cl.quit)
 			c.mu.Lock()
 			delete(c.m, conn)
 			c.mu.Unlock()
+			conn.Close()
+			c.running.done(closeErr)
 
 			dbglog("removed client")
 		}()
 
+		sent := make(map[string]int) // version of the last state sent, by event
+		if err := c.sendStates(conn, sent); err != nil {
+			dbglog("failed to send state: %v", err)
+			return
+		}
+
+		// Replay history so the user interface shows recent data right away.
+		if err := c.sendHistory(conn, cl, past); err != nil {
+			dbglog("failed to send history: %v", err)
+			return
+		}
+
 		for {
 			select {
 			case <-c.ctx.Done():
+				if !c.running.closing() {
+					return
+				}
+				// Let the client acknowledge the close frame, so that it knows
+				// the server went away on purpose.
+				if closeErr = goingAway(conn); closeErr == nil {
+					select {
+					case <-cl.done:
+					case <-time.After(closeTimeout):
+					}
+				}
 				return
-			case msg := <-ch:
-				if err := sendbuf(conn, msg); err != nil {
-					dbglog("failed to send data: %v", err)
+			case <-cl.done:
+				return
+			case cmd := <-cl.cmds:
+				if err := c.apply(conn, cl, cmd); err != nil {
+					dbglog("failed to apply %s command: %v", cmd.name, err)
+					return
+				}
+			case <-cl.frames:
+				frames, dropped := cl.take()
+				if dropped > 0 {
+					dbglog("client lagging behind, dropped %d frames", dropped)
+					if err := sendDropped(conn, dropped); err != nil {
+						dbglog("failed to send dropped frames: %v", err)
+						return
+					}
+				}
+				for _, f := range frames {
+					if err := c.sendFrame(conn, cl, f); err != nil {
+						dbglog("failed to send data: %v", err)
+						return
+					}
+				}
+			case <-cl.states:
+				if err := c.sendStates(conn, sent); err != nil {
+					dbglog("failed to send state: %v", err)
 					return
 				}
 			}
 		}
 	}()
+}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// visible returns the number of connected clients that didn't pause their
+// stream, and the plots at least one of them subscribed to. plots is nil if a
+// client didn't subscribe to specific plots.
+func (c *clients) visible() (plots map[string]bool, n int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	c.m[conn] = ch
+	all := false
+	plots = make(map[string]bool)
+	for _, cl := range c.m {
+		if cl.paused {
+			continue
+		}
+		n++
+		if cl.visible == nil {
+			all = true
+		}
+		for name := range cl.visible {
+			plots[name] = true
+		}
+	}
+	if all {
+		return nil, n
+	}
+	return plots, n
+}
+
+// wakeup signals that metrics might be needed again, in case the collection
+// is paused.
+func (c *clients) wakeup() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
 }
 
-func sendbuf(conn *websocket.Conn, buf []byte) error {
-	w, err := conn.NextWriter(websocket.TextMessage)
+// sendStates sends to conn the states that have been published since the last
+// call. sent holds the versions of the states already sent.
+func (c *clients) sendStates(conn *websocket.Conn, sent map[string]int) error {
+	c.mu.RLock()
+	states := slices.Clone(c.states)
+	c.mu.RUnlock()
+
+	for _, st := range states {
+		if sent[st.event] == st.version {
+			continue
+		}
+		if err := st.msg.send(conn); err != nil {
+			return err
+		}
+		sent[st.event] = st.version
+	}
+	return nil
+}
+
+func sendbuf(conn *websocket.Conn, typ int, buf []byte) error {
+	w, err := conn.NextWriter(typ)
 	if err != nil {
 		return err
 	}
@@ -83,17 +293,60 @@ func sendbuf(conn *websocket.Conn, buf []byte) error {
 	return err2
 }
 
-func (c *clients) broadcast(buf []byte) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// publish broadcasts a state message, which replaces the last published
+// message of the same event, and is sent to new clients. Contrary to metrics,
+// state messages are never dropped, though a client only receives the last
+// message of an event if it's not keeping up.
+func (c *clients) publish(event string, msg jsonmsg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	st := state{event: event, version: c.version, msg: msg}
+	if i := slices.IndexFunc(c.states, func(st state) bool { return st.event == event }); i == -1 {
+		c.states = append(c.states, st)
+	} else {
+		c.states[i] = st
+	}
 
-	for _, ch := range c.m {
+	for _, cl := range c.m {
 		select {
-		case ch <- buf:
+		case cl.states <- struct{}{}:
 		default:
-			// if a client is not keeping up, we
-			// drop the message for that client.
-			dbglog("dropping message to client")
+			// The client has yet to send previously published states.
 		}
 	}
 }
+
+// history returns the metrics messages in the history, oldest first.
+func (c *clients) history() []*frame {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.hist.slice()
+}
+
+func (c *clients) broadcast(f *frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hist.push(f)
+
+	for _, cl := range c.m {
+		if !cl.paused {
+			cl.push(f, c.bufsize)
+		}
+	}
+}
+
+// sendDropped tells the client that it's lagging behind, and that the given
+// number of frames have been merged into others, thus lost.
+func sendDropped(conn *websocket.Conn, n int) error {
+	msg, err := newJSONMsg("dropped", struct {
+		Frames int `json:"frames"`
+	}{n})
+	if err != nil {
+		return err
+	}
+	return msg.send(conn)
+}
@@ -0,0 +1,167 @@
+package statsviz
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+func TestWsVisible(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, SendFrequency(10*time.Millisecond))
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	type metricsMsg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Series map[string][]float64 `json:"series"`
+		} `json:"data"`
+	}
+
+	// All plots are sent until the client tells which ones it shows.
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	var msg metricsMsg
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.Data.Series["goroutines"]; !ok {
+		t.Fatalf("first message lacks goroutines plot")
+	}
+
+	if err := ws.WriteJSON(wsmsg{Event: "subscribe", Data: []string{"cgo"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msg = metricsMsg{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.Data.Series["goroutines"]; !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hidden plots are still sent")
+		}
+	}
+	for _, name := range []string{"cgo", "lastgc"} {
+		if _, ok := msg.Data.Series[name]; !ok {
+			t.Errorf("message lacks %s", name)
+		}
+	}
+}
+
+func TestPauseCollection(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int64
+	tsp, err := TimeSeriesPlotConfig{
+		Name:   "calls",
+		Series: []TimeSeries{{Name: "calls", GetValue: func() float64 { return float64(calls.Add(1)) }}},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer(t, SendFrequency(10*time.Millisecond), TimeseriesPlot(tsp))
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+
+	// Nothing is collected while no client is connected.
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("collected %d times without clients", n)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws.Close()
+
+	// Wait for the client to be removed.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, n := srv.clients.visible(); n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(20 * time.Millisecond) // let an ongoing collection end
+	n := calls.Load()
+	if n == 0 {
+		t.Fatalf("not collected while a client was connected")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if after := calls.Load(); after != n {
+		t.Errorf("collected %d times after the client left", after-n)
+	}
+}
+
+func TestClientQueue(t *testing.T) {
+	cfg := &plot.Config{Events: []string{"lastgc"}}
+	newTestFrame := func(sec int64, series map[string][]float64) *frame {
+		return newFrame(&plot.Frame{Time: time.Unix(sec, 0), Series: series}, cfg)
+	}
+
+	cl := &client{frames: make(chan struct{}, 1)}
+	cl.push(newTestFrame(1, map[string][]float64{"a": {1}, "b": {1}, "lastgc": {1000, 0.1}}), 2)
+	cl.push(newTestFrame(2, map[string][]float64{"a": {2}, "lastgc": {}}), 2)
+	// The queue is full, all frames get merged.
+	cl.push(newTestFrame(3, map[string][]float64{"a": {3}, "lastgc": {3000, 0.3}}), 2)
+	cl.push(newTestFrame(4, map[string][]float64{"a": {4}, "lastgc": {}}), 2)
+
+	frames, dropped := cl.take()
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+
+	merged := frames[0]
+	if merged.Time.Unix() != 3 {
+		t.Errorf("merged frame time = %v, want the newest", merged.Time)
+	}
+	want := map[string][]float64{"a": {3}, "b": {1}, "lastgc": {1000, 0.1, 3000, 0.3}}
+	for name, vals := range want {
+		if !slices.Equal(merged.Series[name], vals) {
+			t.Errorf("merged %s = %v, want %v", name, merged.Series[name], vals)
+		}
+	}
+
+	if frames, dropped := cl.take(); len(frames) != 0 || dropped != 0 {
+		t.Errorf("take() = %d frames, %d dropped after emptying the queue", len(frames), dropped)
+	}
+}
@@ -0,0 +1,121 @@
+// Command statsviz provides standalone Statsviz tools.
+//
+// Usage:
+//
+//	statsviz replay [flags] FILE
+//	statsviz aggregate [flags] [NAME=]URL...
+//
+// The replay command serves the Statsviz user interface and replays a session
+// recorded with the statsviz.Record option.
+//
+// The aggregate command serves the Statsviz user interface showing, in a single
+// dashboard, the metrics of multiple Go programs running Statsviz. Each source
+// is the URL of a Statsviz websocket endpoint, for example
+// ws://host:8080/debug/statsviz/ws.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/arl/statsviz"
+)
+
+const usage = `Usage: statsviz COMMAND [flags] [args]
+
+Commands:
+  replay       replay a recorded session
+  aggregate    show the metrics of multiple programs in a single dashboard
+
+Run 'statsviz COMMAND -h' for more information on a command.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("statsviz: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "replay":
+		replay(args)
+	case "aggregate":
+		aggregate(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	speed := fs.Float64("speed", 1, "replay speed, relative to the recorded pace")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: statsviz replay [flags] FILE\n\n")
+		fmt.Fprintf(fs.Output(), "Serve the Statsviz user interface, replaying a recorded session (optionally gzip-compressed).\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	srv, err := statsviz.NewServer(
+		statsviz.Replay(fs.Arg(0), *speed),
+		statsviz.Root("/"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	srv.Register(mux)
+
+	fmt.Printf("Replaying %s, point your browser to http://%s/\n", fs.Arg(0), *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func aggregate(args []string) {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	interval := fs.Duration("interval", time.Second, "interval between updates")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: statsviz aggregate [flags] [NAME=]URL...\n\n")
+		fmt.Fprintf(fs.Output(), "Serve the Statsviz user interface, showing the metrics of multiple programs.\n")
+		fmt.Fprintf(fs.Output(), "Each URL is a Statsviz websocket endpoint, such as ws://host:8080/debug/statsviz/ws.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	srv, err := statsviz.NewServer(
+		statsviz.Aggregate(fs.Args()...),
+		statsviz.SendFrequency(*interval),
+		statsviz.Root("/"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	srv.Register(mux)
+
+	fmt.Printf("Aggregating %d sources, point your browser to http://%s/\n", fs.NArg(), *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
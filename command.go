@@ -0,0 +1,194 @@
+package statsviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Websocket clients can send commands to the server, as JSON text messages
+// with the same shape as the messages they receive:
+//
+//	{"event": "<command>", "data": <argument>}
+//
+// Commands only affect the client sending them.
+const (
+	// cmdSubscribe restricts the metrics sent to the client to the plots
+	// which names are given as argument, or, if the argument is null, to
+	// all plots. Plots that no client subscribed to aren't collected.
+	cmdSubscribe = "subscribe"
+
+	// cmdPause stops sending metrics to the client, until cmdResume.
+	cmdPause = "pause"
+
+	// cmdResume resumes sending metrics to the client.
+	cmdResume = "resume"
+
+	// cmdInterval sets the minimum interval between metrics messages sent
+	// to the client, in milliseconds. Metrics collected in the meantime are
+	// merged into the next message. 0 restores the server interval.
+	cmdInterval = "interval"
+
+	// cmdHistory asks the server to send its history again. See [History].
+	cmdHistory = "history"
+)
+
+// maxClientMsgSize is the maximum size of a message sent by a client.
+const maxClientMsgSize = 64 << 10
+
+// clientmsg is a message sent by a websocket client.
+type clientmsg struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// command is a decoded client command.
+type command struct {
+	name     string
+	plots    map[string]bool // cmdSubscribe
+	interval time.Duration   // cmdInterval
+}
+
+// parseCommand decodes and validates a client command.
+func parseCommand(buf []byte) (command, error) {
+	var msg clientmsg
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return command{}, err
+	}
+
+	cmd := command{name: msg.Event}
+	switch msg.Event {
+	case cmdSubscribe:
+		var names []string
+		if err := json.Unmarshal(msg.Data, &names); err != nil {
+			return cmd, fmt.Errorf("%s: %v", msg.Event, err)
+		}
+		if names != nil {
+			cmd.plots = make(map[string]bool, len(names))
+			for _, name := range names {
+				cmd.plots[name] = true
+			}
+		}
+	case cmdInterval:
+		var ms int64
+		if err := json.Unmarshal(msg.Data, &ms); err != nil {
+			return cmd, fmt.Errorf("%s: %v", msg.Event, err)
+		}
+		if ms < 0 {
+			return cmd, fmt.Errorf("%s: negative interval", msg.Event)
+		}
+		cmd.interval = time.Duration(ms) * time.Millisecond
+	case cmdPause, cmdResume, cmdHistory:
+	default:
+		return cmd, fmt.Errorf("unknown command %q", msg.Event)
+	}
+	return cmd, nil
+}
+
+// read reads the commands sent by the client and passes them to the client
+// goroutine, until the connection is closed. It then closes cl.done.
+func (c *clients) read(conn *websocket.Conn, cl *client) {
+	defer close(cl.done)
+
+	conn.SetReadLimit(maxClientMsgSize)
+	for {
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		cmd, err := parseCommand(buf)
+		if err != nil {
+			dbglog("invalid client command: %v", err)
+			continue
+		}
+
+		select {
+		case cl.cmds <- cmd:
+		case <-cl.quit:
+			return
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// apply applies a command sent by the client.
+func (c *clients) apply(conn *websocket.Conn, cl *client, cmd command) error {
+	switch cmd.name {
+	case cmdSubscribe:
+		c.mu.Lock()
+		cl.visible = cmd.plots
+		c.mu.Unlock()
+		c.wakeup()
+	case cmdPause:
+		c.mu.Lock()
+		cl.paused = true
+		c.mu.Unlock()
+		cl.pending = nil
+	case cmdResume:
+		c.mu.Lock()
+		cl.paused = false
+		c.mu.Unlock()
+		c.wakeup()
+	case cmdInterval:
+		cl.interval = cmd.interval
+		if cl.interval == 0 && cl.pending != nil {
+			f := cl.pending
+			cl.pending = nil
+			return c.sendFrame(conn, cl, f)
+		}
+	case cmdHistory:
+		c.mu.RLock()
+		past := c.hist.slice()
+		c.mu.RUnlock()
+		return c.sendHistory(conn, cl, past)
+	}
+	return nil
+}
+
+// sendFrame sends f to the client, unless the client paused its stream. If
+// the client asked for a longer interval, f is merged into the next frames
+// until it's time to send them.
+func (c *clients) sendFrame(conn *websocket.Conn, cl *client, f *frame) error {
+	c.mu.RLock()
+	paused, visible := cl.paused, cl.visible
+	c.mu.RUnlock()
+
+	if paused {
+		return nil
+	}
+	if cl.pending != nil {
+		f = cl.pending.merge(f)
+		cl.pending = nil
+	}
+	// Tolerate some jitter of the collection ticks.
+	if cl.interval > 0 && f.Time.Sub(cl.lastSent) < cl.interval-c.tick/2 {
+		cl.pending = f
+		return nil
+	}
+	if visible != nil {
+		f = f.only(visible)
+	}
+	cl.lastSent = f.Time
+	return f.send(conn)
+}
+
+// sendHistory sends the given past frames to the client.
+func (c *clients) sendHistory(conn *websocket.Conn, cl *client, past []*frame) error {
+	c.mu.RLock()
+	visible := cl.visible
+	c.mu.RUnlock()
+
+	for _, f := range past {
+		if visible != nil {
+			f = f.only(visible)
+		}
+		if err := f.send(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+//go:build go1.25
+// +build go1.25
+
+package statsviz
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+func TestParseCommand(t *testing.T) {
+	valid := []string{
+		`{"event":"subscribe","data":["cgo","goroutines"]}`,
+		`{"event":"subscribe","data":null}`,
+		`{"event":"pause"}`,
+		`{"event":"resume"}`,
+		`{"event":"interval","data":5000}`,
+		`{"event":"history"}`,
+	}
+	for _, msg := range valid {
+		if _, err := parseCommand([]byte(msg)); err != nil {
+			t.Errorf("parseCommand(%s) returned %v", msg, err)
+		}
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"event":"unknown"}`,
+		`{"event":"subscribe","data":"cgo"}`,
+		`{"event":"interval","data":-1}`,
+		`{"event":"interval","data":"1s"}`,
+	}
+	for _, msg := range invalid {
+		if _, err := parseCommand([]byte(msg)); err == nil {
+			t.Errorf("parseCommand(%s) should have failed", msg)
+		}
+	}
+}
+
+func TestWsCommands(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		srv := newServer(t, SendFrequency(time.Second), History(3))
+		defer srv.Close()
+
+		u, dialer := startSynctestServer(t, srv.Ws())
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		type metricsMsg struct {
+			Event string `json:"event"`
+			Data  struct {
+				Timestamp int64                `json:"timestamp"`
+				Series    map[string][]float64 `json:"series"`
+			} `json:"data"`
+		}
+		read := func() metricsMsg {
+			t.Helper()
+			var msg metricsMsg
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			return msg
+		}
+		command := func(event string, data any) {
+			t.Helper()
+			if err := ws.WriteJSON(wsmsg{Event: event, Data: data}); err != nil {
+				t.Fatal(err)
+			}
+			synctest.Wait()
+		}
+
+		if _, _, err := ws.ReadMessage(); err != nil { // config
+			t.Fatal(err)
+		}
+		var last metricsMsg
+		for range 3 {
+			last = read()
+		}
+
+		// Nothing is sent while paused.
+		command("pause", nil)
+		time.Sleep(5 * time.Second)
+		resumed := time.Now()
+		command("resume", nil)
+		if msg := read(); msg.Data.Timestamp < resumed.UnixMilli() {
+			t.Errorf("received metrics of %d while paused (resumed at %d)", msg.Data.Timestamp, resumed.UnixMilli())
+		}
+
+		// History is sent again on demand.
+		command("history", nil)
+		var history []int64
+		for range 3 {
+			history = append(history, read().Data.Timestamp)
+		}
+		if history[0] <= last.Data.Timestamp || history[2] < resumed.UnixMilli() {
+			t.Errorf("history timestamps = %v, want the last 3 metrics", history)
+		}
+
+		// Only the subscribed plots are sent.
+		command("subscribe", []string{"cgo"})
+		msg := read()
+		if len(msg.Data.Series) != 2 || msg.Data.Series["cgo"] == nil || msg.Data.Series["lastgc"] == nil {
+			t.Errorf("got series %v, want cgo and lastgc only", msg.Data.Series)
+		}
+
+		// Metrics are sent at the client interval.
+		command("interval", 3000)
+		prev := read().Data.Timestamp
+		for range 3 {
+			ts := read().Data.Timestamp
+			if ts-prev != 3000 {
+				t.Errorf("got metrics %dms apart, want 3000ms", ts-prev)
+			}
+			prev = ts
+		}
+
+		// Closed connections are detected.
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		ws.Close()
+		synctest.Wait()
+		if _, n := srv.clients.visible(); n != 0 {
+			t.Errorf("%d clients still registered after close", n)
+		}
+	})
+}
+
+func TestReadAfterClientQuit(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		c := newClients(context.Background(), &plot.Config{}, 0, time.Second, 0, &tracker{})
+		returned := make(chan struct{})
+		u, dialer := startSynctestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+
+			// The client goroutine returned, nobody receives commands anymore.
+			cl := &client{cmds: make(chan command), done: make(chan struct{}), quit: make(chan struct{})}
+			close(cl.quit)
+			c.read(conn, cl)
+			close(returned)
+		}))
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"event":"pause"}`)); err != nil {
+			t.Fatal(err)
+		}
+		synctest.Wait()
+		select {
+		case <-returned:
+		default:
+			t.Errorf("read is blocked passing a command to a client that quit")
+		}
+	})
+}
@@ -0,0 +1,151 @@
+//go:build go1.25
+// +build go1.25
+
+package statsviz
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestCompressionOption(t *testing.T) {
+	for _, level := range []int{flate.HuffmanOnly - 1, flate.BestCompression + 1} {
+		if _, err := NewServer(Compression(level)); err == nil {
+			t.Errorf("NewServer(Compression(%d)) should have errored", level)
+		}
+	}
+}
+
+// recordConn records all bytes read from a net.Conn.
+type recordConn struct {
+	net.Conn
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.buf.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// wsFrame is the header of a websocket frame.
+type wsFrame struct {
+	rsv1   bool
+	opcode byte
+}
+
+// parseFrames parses the websocket frames sent by a server, from the raw data
+// read by the client, HTTP handshake included.
+func parseFrames(t *testing.T, raw []byte) []wsFrame {
+	t.Helper()
+
+	_, raw, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		t.Fatalf("handshake not found")
+	}
+
+	var frames []wsFrame
+	for len(raw) >= 2 {
+		f := wsFrame{rsv1: raw[0]&0x40 != 0, opcode: raw[0] & 0x0f}
+		n, hdr := uint64(raw[1]&0x7f), 2
+		switch n {
+		case 126:
+			n, hdr = uint64(binary.BigEndian.Uint16(raw[2:])), 4
+		case 127:
+			n, hdr = binary.BigEndian.Uint64(raw[2:]), 10
+		}
+		if uint64(len(raw)) < uint64(hdr)+n {
+			break // incomplete frame
+		}
+		raw = raw[uint64(hdr)+n:]
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func TestWsCompression(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		clientCompress bool
+		wantCompressed bool
+	}{
+		{name: "client with compression", clientCompress: true, wantCompressed: true},
+		{name: "client without compression", clientCompress: false, wantCompressed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				srv := newServer(t, Compression(flate.BestCompression), SendFrequency(time.Second))
+				defer srv.Close()
+
+				u, dialer := startSynctestServer(t, srv.Ws())
+
+				var conn *recordConn
+				dial := dialer.NetDialContext
+				dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+					c, err := dial(ctx, network, addr)
+					conn = &recordConn{Conn: c}
+					return conn, err
+				}
+				dialer.EnableCompression = tt.clientCompress
+
+				ws, resp, err := dialer.Dial(u, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer ws.Close()
+
+				ext := resp.Header.Get("Sec-WebSocket-Extensions")
+				if negotiated := ext != ""; negotiated != tt.wantCompressed {
+					t.Errorf("Sec-WebSocket-Extensions = %q", ext)
+				}
+
+				var cfg map[string]any
+				if err := ws.ReadJSON(&cfg); err != nil {
+					t.Fatal(err)
+				}
+				for range 2 {
+					var msg metricsMsg
+					if err := ws.ReadJSON(&msg); err != nil {
+						t.Fatal(err)
+					}
+					if msg.Event != "metrics" {
+						t.Errorf("got %q event, want metrics", msg.Event)
+					}
+				}
+
+				conn.mu.Lock()
+				frames := parseFrames(t, conn.buf.Bytes())
+				conn.mu.Unlock()
+
+				var msgs int
+				for _, f := range frames {
+					if f.opcode == 0 {
+						// Continuation frames never have RSV1 set.
+						continue
+					}
+					msgs++
+					if f.rsv1 != tt.wantCompressed {
+						t.Errorf("frame with opcode %d has RSV1 = %t, want %t", f.opcode, f.rsv1, tt.wantCompressed)
+					}
+				}
+				if msgs < 3 {
+					t.Errorf("parsed %d messages, want at least 3", msgs)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package statsviz
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// Export returns a handler serving the recent values of the plots, those kept
+// in the history set with [History], as JSON or CSV. By default, the handler
+// is served at root+"/export".
+//
+// The following query parameters are supported:
+//   - plot: name of a plot to export, as in the plots configuration. It can be
+//     repeated. default: all plots.
+//   - from, to: bounds of the time range to export, inclusive, as RFC 3339
+//     timestamps or milliseconds since the Unix epoch. default: unbounded.
+//   - last: duration, like "5m", of the time range to export, ending now. It
+//     can't be used with from and to.
+//   - format: either "json" or "csv". default: "json".
+//
+// In JSON, the response is an array of [Snapshot], oldest first. In CSV, each
+// row holds the values at a given instant, oldest first. The first column is
+// the time, in milliseconds since the Unix epoch, followed by a column per
+// time series, named plot/series, and per heatmap bucket, named plot/bound
+// where bound is the bucket upper bound. Cells of plots that weren't collected
+// at that instant are empty.
+func (s *Server) Export() http.HandlerFunc {
+	return s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		if s.clients == nil {
+			http.Error(w, "history is not available when replaying a session", http.StatusNotFound)
+			return
+		}
+		if s.histsize == 0 {
+			http.Error(w, "history is disabled, see the History option", http.StatusNotFound)
+			return
+		}
+
+		cfg := s.clients.cfg
+		q, err := parseExportQuery(r.URL.Query(), cfg, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snaps := []Snapshot{}
+		for _, f := range s.clients.history() {
+			if f.Time.Before(q.from) || !q.to.IsZero() && f.Time.After(q.to) {
+				continue
+			}
+			snap := f.snapshot()
+			snap.Plots = slices.DeleteFunc(snap.Plots, func(p PlotSnapshot) bool {
+				return !q.plots[p.Name]
+			})
+			if len(snap.Plots) > 0 {
+				snaps = append(snaps, snap)
+			}
+		}
+
+		switch q.format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="statsviz.csv"`)
+			err = writeCSV(w, cfg, q.plots, snaps)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="statsviz.json"`)
+			err = json.NewEncoder(w).Encode(snaps)
+		}
+		if err != nil {
+			dbglog("failed to export history: %v", err)
+		}
+	})
+}
+
+// exportQuery holds the parameters of an export request.
+type exportQuery struct {
+	plots    map[string]bool // plots to export
+	from, to time.Time       // time range, the zero time meaning unbounded
+	format   string
+}
+
+func parseExportQuery(values url.Values, cfg *plot.Config, now time.Time) (exportQuery, error) {
+	q := exportQuery{
+		plots:  make(map[string]bool),
+		format: "json",
+	}
+
+	var known []string
+	for _, layout := range cfg.Series {
+		known = append(known, plot.LayoutName(layout))
+	}
+	for _, name := range values["plot"] {
+		if !slices.Contains(known, name) {
+			return q, fmt.Errorf("unknown plot %q", name)
+		}
+		q.plots[name] = true
+	}
+	if len(q.plots) == 0 {
+		for _, name := range known {
+			q.plots[name] = true
+		}
+	}
+
+	var err error
+	if v := values.Get("from"); v != "" {
+		if q.from, err = parseExportTime(v); err != nil {
+			return q, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if v := values.Get("to"); v != "" {
+		if q.to, err = parseExportTime(v); err != nil {
+			return q, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if v := values.Get("last"); v != "" {
+		if !q.from.IsZero() || !q.to.IsZero() {
+			return q, fmt.Errorf("last can't be used with from and to")
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return q, fmt.Errorf("invalid last: must be a positive duration")
+		}
+		q.from = now.Add(-d)
+	}
+
+	switch v := values.Get("format"); v {
+	case "", "json":
+	case "csv":
+		q.format = v
+	default:
+		return q, fmt.Errorf("unsupported format %q", v)
+	}
+	return q, nil
+}
+
+// parseExportTime parses an RFC 3339 timestamp or a number of milliseconds
+// since the Unix epoch.
+func parseExportTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// writeCSV writes the snapshots of the given plots as CSV.
+func writeCSV(w io.Writer, cfg *plot.Config, plots map[string]bool, snaps []Snapshot) error {
+	type span struct{ start, n int } // columns of a plot
+	header := []string{"time"}
+	spans := make(map[string]span)
+	for _, layout := range cfg.Series {
+		name := plot.LayoutName(layout)
+		if !plots[name] {
+			continue
+		}
+		start := len(header)
+		switch layout := layout.(type) {
+		case plot.Scatter:
+			for _, sp := range layout.Subplots {
+				header = append(header, name+"/"+sp.Name)
+			}
+		case plot.Heatmap:
+			for _, b := range layout.CustomData {
+				header = append(header, name+"/"+strconv.FormatFloat(b, 'g', -1, 64))
+			}
+		}
+		spans[name] = span{start: start, n: len(header) - start}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	row := make([]string, len(header))
+	for _, snap := range snaps {
+		clear(row)
+		row[0] = strconv.FormatInt(snap.Time.UnixMilli(), 10)
+		for _, p := range snap.Plots {
+			sp := spans[p.Name]
+			for i, v := range p.Values[:min(len(p.Values), sp.n)] {
+				row[sp.start+i] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,118 @@
+package statsviz
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	tsp, err := TimeSeriesPlotConfig{
+		Name: "requests",
+		Series: []TimeSeries{
+			{Name: "ok", GetValue: func() float64 { return 3 }},
+			{Name: "failed", GetValue: func() float64 { return 1 }},
+		},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(t, SendFrequency(10*time.Millisecond), History(10), TimeseriesPlot(tsp))
+	defer srv.Close()
+
+	get := func(query string) *http.Response {
+		req := httptest.NewRequest("GET", "http://example.com/debug/statsviz/export?"+query, nil)
+		w := httptest.NewRecorder()
+		srv.Export()(w, req)
+		return w.Result()
+	}
+	getJSON := func(query string) []Snapshot {
+		t.Helper()
+		resp := get(query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET ?%s: status = %d", query, resp.StatusCode)
+		}
+		var snaps []Snapshot
+		if err := json.NewDecoder(resp.Body).Decode(&snaps); err != nil {
+			t.Fatal(err)
+		}
+		return snaps
+	}
+
+	// Wait for the history to hold some metrics.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(getJSON("plot=requests")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("history is empty")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	snaps := getJSON("plot=requests&last=1h")
+	for _, snap := range snaps {
+		if len(snap.Plots) != 1 || snap.Plots[0].Name != "requests" || len(snap.Plots[0].Values) != 2 {
+			t.Fatalf("snapshot plots = %+v, want requests only", snap.Plots)
+		}
+	}
+	if all := getJSON(""); len(all[0].Plots) < 2 {
+		t.Errorf("got %d plots without plot parameter, want all", len(all[0].Plots))
+	}
+	future := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	if snaps := getJSON("from=" + future); len(snaps) != 0 {
+		t.Errorf("got %d snapshots from the future", len(snaps))
+	}
+	if snaps := getJSON("to=2000-01-01T00:00:00Z"); len(snaps) != 0 {
+		t.Errorf("got %d snapshots before 2000", len(snaps))
+	}
+
+	resp := get("plot=requests&plot=cgo&format=csv")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("header[Content-Type] = %s, want text/csv", ct)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) < 3 {
+		t.Fatalf("got %d CSV records, want header and at least 2 rows", len(records))
+	}
+	// Plots are in the configuration order.
+	if got, want := strings.Join(records[0], ","), "time,cgo/calls from go to c,requests/ok,requests/failed"; got != want {
+		t.Errorf("CSV header = %s, want %s", got, want)
+	}
+	if row := records[1]; row[2] != "3" || row[3] != "1" {
+		t.Errorf("CSV row = %v, want requests values 3 and 1", row)
+	}
+
+	for _, query := range []string{
+		"plot=unknown",
+		"format=xml",
+		"from=yesterday",
+		"last=-5m",
+		"last=5m&from=0",
+	} {
+		if resp := get(query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET ?%s: status = %d, want %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestExportNoHistory(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t)
+	defer srv.Close()
+
+	w := httptest.NewRecorder()
+	srv.Export()(w, httptest.NewRequest("GET", "http://example.com/debug/statsviz/export", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
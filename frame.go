@@ -0,0 +1,99 @@
+package statsviz
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// packedProtocol is the websocket subprotocol with which a client asks for
+// metrics messages in the packed binary format, rather than in JSON. See
+// [plot.Frame.AppendPacked] for the format description.
+const packedProtocol = "statsviz.packed.v1"
+
+// frame is a metrics message. It's encoded in the wire format requested by
+// each client, at most once per format.
+type frame struct {
+	*plot.Frame
+	cfg *plot.Config
+
+	jsonOnce sync.Once
+	jsonBuf  []byte
+	jsonErr  error
+
+	packedOnce sync.Once
+	packedBuf  []byte
+}
+
+func newFrame(f *plot.Frame, cfg *plot.Config) *frame {
+	return &frame{Frame: f, cfg: cfg}
+}
+
+// json returns the frame encoded in JSON.
+func (f *frame) json() ([]byte, error) {
+	f.jsonOnce.Do(func() {
+		var buf bytes.Buffer
+		f.jsonErr = f.WriteJSON(&buf)
+		f.jsonBuf = buf.Bytes()
+	})
+	return f.jsonBuf, f.jsonErr
+}
+
+// packed returns the frame encoded in the packed format.
+func (f *frame) packed() []byte {
+	f.packedOnce.Do(func() {
+		f.packedBuf = f.AppendPacked(nil, f.cfg)
+	})
+	return f.packedBuf
+}
+
+// send sends the frame to conn, in the wire format negotiated with the client.
+func (f *frame) send(conn *websocket.Conn) error {
+	if conn.Subprotocol() == packedProtocol {
+		return sendbuf(conn, websocket.BinaryMessage, f.packed())
+	}
+	buf, err := f.json()
+	if err != nil {
+		return err
+	}
+	return sendbuf(conn, websocket.TextMessage, buf)
+}
+
+// merge returns a frame holding the values of f updated with those of next,
+// which is more recent. Events of both frames are kept.
+func (f *frame) merge(next *frame) *frame {
+	series := maps.Clone(f.Series)
+	maps.Copy(series, next.Series)
+	for _, evt := range f.cfg.Events {
+		if f.Series[evt] != nil {
+			series[evt] = append(slices.Clip(f.Series[evt]), next.Series[evt]...)
+		}
+	}
+	return newFrame(&plot.Frame{Time: next.Time, Series: series}, f.cfg)
+}
+
+// only returns a frame holding the events of f and the plots in the given set.
+// It returns f if it has no other plots.
+func (f *frame) only(plots map[string]bool) *frame {
+	isEvent := func(name string) bool { return slices.Contains(f.cfg.Events, name) }
+
+	var series map[string][]float64
+	for name := range f.Series {
+		if plots[name] || isEvent(name) {
+			continue
+		}
+		if series == nil {
+			series = maps.Clone(f.Series)
+		}
+		delete(series, name)
+	}
+	if series == nil {
+		return f
+	}
+	return newFrame(&plot.Frame{Time: f.Time, Series: series}, f.cfg)
+}
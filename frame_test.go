@@ -0,0 +1,113 @@
+package statsviz
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// unpack decodes a packed metrics message, given the ordered names of the
+// events and plots of the configuration.
+func unpack(t *testing.T, buf []byte, names []string) (int64, map[string][]float64) {
+	t.Helper()
+
+	var floats []float64
+	for i := 0; i+8 <= len(buf); i += 8 {
+		floats = append(floats, math.Float64frombits(binary.LittleEndian.Uint64(buf[i:])))
+	}
+	if len(floats) == 0 || len(floats)*8 != len(buf) {
+		t.Fatalf("malformed packed message of %d bytes", len(buf))
+	}
+
+	ts := int64(floats[0])
+	series := make(map[string][]float64)
+	floats = floats[1:]
+	for _, name := range names {
+		if len(floats) == 0 {
+			t.Fatalf("packed message is missing %q", name)
+		}
+		n := int(floats[0])
+		floats = floats[1:]
+		if n < 0 {
+			continue
+		}
+		if n > len(floats) {
+			t.Fatalf("packed message is truncated in %q", name)
+		}
+		series[name] = floats[:n]
+		floats = floats[n:]
+	}
+	if len(floats) != 0 {
+		t.Fatalf("packed message has %d trailing values", len(floats))
+	}
+	return ts, series
+}
+
+func TestWsPacked(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, SendFrequency(10*time.Millisecond))
+	defer srv.Close()
+
+	s := httptest.NewServer(srv.Ws())
+	defer s.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{packedProtocol}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if ws.Subprotocol() != packedProtocol {
+		t.Fatalf("negotiated subprotocol %q, want %q", ws.Subprotocol(), packedProtocol)
+	}
+
+	// The configuration is still sent as JSON.
+	var cfg struct {
+		Data struct {
+			Series []struct {
+				Name string `json:"name"`
+			} `json:"series"`
+			Events []string `json:"events"`
+		} `json:"data"`
+	}
+	if err := ws.ReadJSON(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	names := cfg.Data.Events
+	for _, s := range cfg.Data.Series {
+		names = append(names, s.Name)
+	}
+
+	for i := range 2 {
+		typ, buf, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != websocket.BinaryMessage {
+			t.Fatalf("message type = %d, want binary", typ)
+		}
+
+		ts, series := unpack(t, buf, names)
+		if since := time.Since(time.UnixMilli(ts)); since < 0 || since > time.Minute {
+			t.Errorf("timestamp %v is off", time.UnixMilli(ts))
+		}
+		if lastgc, ok := series["lastgc"]; !ok || len(lastgc)%2 != 0 {
+			t.Errorf("lastgc = %v, want (end, pause) pairs", lastgc)
+		}
+		if len(series["cgo"]) != 1 {
+			t.Errorf("len(cgo) = %d, want 1", len(series["cgo"]))
+		}
+		// size-classes is collected less often, so it's only in the first
+		// message, where all plots are.
+		if i == 0 && len(series["size-classes"]) <= 1 {
+			t.Errorf("len(size-classes) = %d, want > 1", len(series["size-classes"]))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package statsviz
+
+// history is a fixed-size ring buffer holding the last metrics messages
+// broadcast to websocket clients. It's not safe for concurrent use.
+type history struct {
+	buf   []*frame
+	start int
+	size  int
+}
+
+func newHistory(capacity int) *history {
+	return &history{buf: make([]*frame, capacity)}
+}
+
+// push adds msg to the history, evicting the oldest message if full.
+func (h *history) push(msg *frame) {
+	if len(h.buf) == 0 {
+		return
+	}
+
+	end := (h.start + h.size) % len(h.buf)
+	h.buf[end] = msg
+	if h.size < len(h.buf) {
+		h.size++
+	} else {
+		h.start = (h.start + 1) % len(h.buf)
+	}
+}
+
+// slice returns the messages in the history, oldest first.
+func (h *history) slice() []*frame {
+	msgs := make([]*frame, h.size)
+	for i := range msgs {
+		msgs[i] = h.buf[(h.start+i)%len(h.buf)]
+	}
+	return msgs
+}
@@ -0,0 +1,48 @@
+package statsviz
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	msg := func(s string) *frame { return &frame{jsonBuf: []byte(s)} }
+	strs := func(msgs []*frame) []string {
+		var ss []string
+		for _, m := range msgs {
+			ss = append(ss, string(m.jsonBuf))
+		}
+		return ss
+	}
+
+	tests := []struct {
+		name string
+		cap  int
+		push []string
+		want []string
+	}{
+		{name: "disabled", cap: 0, push: []string{"a", "b"}, want: nil},
+		{name: "empty", cap: 3, push: nil, want: nil},
+		{name: "partial", cap: 3, push: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "full", cap: 3, push: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{name: "wrap", cap: 3, push: []string{"a", "b", "c", "d", "e"}, want: []string{"c", "d", "e"}},
+		{name: "wrap twice", cap: 2, push: []string{"a", "b", "c", "d", "e"}, want: []string{"d", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(tt.cap)
+			for _, s := range tt.push {
+				h.push(msg(s))
+			}
+			if got := strs(h.slice()); !slices.Equal(got, tt.want) {
+				t.Errorf("slice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryOption(t *testing.T) {
+	if _, err := NewServer(History(-1)); err == nil {
+		t.Errorf("NewServer(History(-1)) should have errored")
+	}
+}
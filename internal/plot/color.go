@@ -1,8 +1,10 @@
 package plot
 
 import (
+	"encoding/json"
 	"fmt"
 	"image/color"
+	"math"
 )
 
 func RGBString(r, g, b uint8) string {
@@ -20,6 +22,30 @@ func (c WeightedColor) MarshalJSON() ([]byte, error) {
 	return []byte(str), nil
 }
 
+func (c *WeightedColor) UnmarshalJSON(data []byte) error {
+	var (
+		tuple [2]json.RawMessage
+		rgb   string
+		r, g  uint8
+		b     uint8
+		a     float64
+	)
+	if err := json.Unmarshal(data, &tuple); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tuple[0], &c.Value); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tuple[1], &rgb); err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(rgb, "rgb(%d,%d,%d,%g)", &r, &g, &b, &a); err != nil {
+		return fmt.Errorf("invalid color %q: %v", rgb, err)
+	}
+	c.Color = color.RGBA{r, g, b, uint8(math.Round(a * 255))}
+	return nil
+}
+
 // NOTE: shades obtained from https://mdigi.tools/color-shades/
 
 var BlueShades = []WeightedColor{
@@ -0,0 +1,22 @@
+package plot
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestWeightedColorJSON(t *testing.T) {
+	buf, err := json.Marshal(BlueShades)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []WeightedColor
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, BlueShades) {
+		t.Errorf("got %v, want %v", got, BlueShades)
+	}
+}
@@ -0,0 +1,72 @@
+package plot
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Frame holds the values of all plots and events at a given instant.
+type Frame struct {
+	Time   time.Time
+	Series map[string][]float64 // values by plot or event name
+}
+
+// WriteJSON writes into w the frame as a JSON metrics message.
+func (f *Frame) WriteJSON(w io.Writer) error {
+	type data struct {
+		Series    map[string][]float64 `json:"series"`
+		Timestamp int64                `json:"timestamp"`
+	}
+
+	if err := json.NewEncoder(w).Encode(struct {
+		Event string `json:"event"`
+		Data  data   `json:"data"`
+	}{
+		Event: "metrics",
+		Data: data{
+			Series:    f.Series,
+			Timestamp: f.Time.UnixMilli(),
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write/convert metrics values to json: %v", err)
+	}
+	return nil
+}
+
+// AppendPacked appends to b the frame in the packed format, and returns the
+// extended buffer.
+//
+// A packed frame is a sequence of little-endian IEEE 754 float64. The first
+// one is the timestamp, in milliseconds since the Unix epoch. Then, for each
+// event and plot of cfg, in order, comes the number of values followed by the
+// values themselves. A negative count means that the frame holds no values for
+// that event or plot.
+func (f *Frame) AppendPacked(b []byte, cfg *Config) []byte {
+	b = appendFloat64(b, float64(f.Time.UnixMilli()))
+	for _, evt := range cfg.Events {
+		b = appendPackedValues(b, f.Series[evt])
+	}
+	for _, layout := range cfg.Series {
+		b = appendPackedValues(b, f.Series[LayoutName(layout)])
+	}
+	return b
+}
+
+func appendPackedValues(b []byte, vals []float64) []byte {
+	if vals == nil {
+		return appendFloat64(b, -1)
+	}
+	b = appendFloat64(b, float64(len(vals)))
+	for _, v := range vals {
+		b = appendFloat64(b, v)
+	}
+	return b
+}
+
+func appendFloat64(b []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+}
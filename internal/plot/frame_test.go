@@ -0,0 +1,300 @@
+package plot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"maps"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameAppendPacked(t *testing.T) {
+	cfg := &Config{
+		Events: []string{"lastgc"},
+		Series: []any{
+			Scatter{Name: "scatter"},
+			Heatmap{Name: "heatmap"},
+			Scatter{Name: "missing"},
+		},
+	}
+	f := &Frame{
+		Time: time.UnixMilli(1700000000123),
+		Series: map[string][]float64{
+			"lastgc":  {1700000000000},
+			"scatter": {1.5, -2},
+			"heatmap": {1, 2, 3},
+		},
+	}
+
+	buf := f.AppendPacked([]byte("prefix"), cfg)
+	if !bytes.HasPrefix(buf, []byte("prefix")) {
+		t.Fatalf("AppendPacked didn't append to the buffer")
+	}
+	buf = buf[len("prefix"):]
+
+	if len(buf)%8 != 0 {
+		t.Fatalf("len(packed) = %d, want a multiple of 8", len(buf))
+	}
+	var got []float64
+	for i := 0; i < len(buf); i += 8 {
+		got = append(got, math.Float64frombits(binary.LittleEndian.Uint64(buf[i:])))
+	}
+
+	want := []float64{
+		1700000000123,
+		1, 1700000000000,
+		2, 1.5, -2,
+		3, 1, 2, 3,
+		-1,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("packed frame = %v, want %v", got, want)
+	}
+}
+
+func TestFrameWriteJSON(t *testing.T) {
+	f := &Frame{
+		Time:   time.UnixMilli(1700000000123),
+		Series: map[string][]float64{"lastgc": {1}, "scatter": {1.5}},
+	}
+
+	var buf bytes.Buffer
+	if err := f.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Series    map[string][]float64 `json:"series"`
+			Timestamp int64                `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "metrics" || msg.Data.Timestamp != 1700000000123 {
+		t.Errorf("got event %q and timestamp %d", msg.Event, msg.Data.Timestamp)
+	}
+	if got := msg.Data.Series["scatter"]; !slices.Equal(got, []float64{1.5}) {
+		t.Errorf("scatter = %v, want [1.5]", got)
+	}
+}
+
+func TestCollectGCEvents(t *testing.T) {
+	pl, err := NewList(nil, time.Second, nil, Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl.Config()
+	pl.Collect(nil)
+
+	before := time.Now()
+	runtime.GC()
+	runtime.GC()
+	runtime.GC()
+
+	events := pl.Collect(nil).Series["lastgc"]
+	if len(events) < 6 || len(events)%2 != 0 {
+		t.Fatalf("lastgc = %v, want at least 3 (end, pause) pairs", events)
+	}
+	var prev float64
+	for i := 0; i < len(events); i += 2 {
+		end, pause := events[i], events[i+1]
+		if end < float64(before.UnixMilli()) || end < prev {
+			t.Errorf("gc %d ended at %v, want increasing times after %v", i/2, end, before.UnixMilli())
+		}
+		if pause <= 0 || pause > 1 {
+			t.Errorf("gc %d paused for %vs", i/2, pause)
+		}
+		prev = end
+	}
+
+	// Garbage collections are only sent once.
+	if events := pl.Collect(nil).Series["lastgc"]; len(events) > 2 {
+		t.Errorf("lastgc = %v, want at most 1 new garbage collection", events)
+	}
+}
+
+func TestCollectIntervals(t *testing.T) {
+	userPlots := []UserPlot{
+		{Scatter: &ScatterUserPlot{
+			Plot:     Scatter{Name: "user", Subplots: []Subplot{{Name: "a"}}},
+			Funcs:    []func() float64{func() float64 { return 1 }},
+			Interval: time.Hour,
+		}},
+	}
+	pl, err := NewList(userPlots, time.Minute, map[string]time.Duration{
+		"cgo":        time.Millisecond,
+		"goroutines": time.Hour,
+	}, Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tick := pl.Tick(); tick != time.Millisecond {
+		t.Errorf("Tick() = %v, want 1ms", tick)
+	}
+	intervals := map[string]int64{}
+	for _, layout := range pl.Config().Series {
+		switch layout := layout.(type) {
+		case Scatter:
+			intervals[layout.Name] = layout.Interval
+		case Heatmap:
+			intervals[layout.Name] = layout.Interval
+		}
+	}
+	want := map[string]int64{"cgo": 1, "goroutines": 3600000, "user": 3600000, "gc-cycles": 0, "size-classes": 300000}
+	for name, ms := range want {
+		if intervals[name] != ms {
+			t.Errorf("%s layout interval = %d, want %d", name, intervals[name], ms)
+		}
+	}
+
+	// All plots are collected the first time.
+	series := pl.Collect(nil).Series
+	for _, name := range []string{"lastgc", "cgo", "goroutines", "user", "size-classes"} {
+		if _, ok := series[name]; !ok {
+			t.Errorf("first collection: missing %s", name)
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	series = pl.Collect(nil).Series
+	for name, due := range map[string]bool{"lastgc": true, "cgo": true, "goroutines": false, "user": false, "size-classes": false} {
+		if _, ok := series[name]; ok != due {
+			t.Errorf("second collection: got %s = %t, want %t", name, ok, due)
+		}
+	}
+
+	// Plots not collected keep their last values.
+	var buf bytes.Buffer
+	if err := pl.WriteMetrics(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("statsviz_goroutines")) {
+		t.Errorf("metrics lack goroutines:\n%s", buf.String())
+	}
+}
+
+func TestCollectDeclaredIntervals(t *testing.T) {
+	pl, err := NewList(nil, 50*time.Millisecond, nil, Selection{Include: []string{"cgo", "size-classes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tick := pl.Tick(); tick != 50*time.Millisecond {
+		t.Errorf("Tick() = %v, want 50ms", tick)
+	}
+
+	// size-classes is collected every 5 ticks, cgo at every tick.
+	start := time.Now()
+	pl.Collect(nil)
+	for range 2 {
+		time.Sleep(50 * time.Millisecond)
+		series := pl.Collect(nil).Series
+		if series["cgo"] == nil {
+			t.Errorf("cgo not collected after %v", time.Since(start))
+		}
+		if series["size-classes"] != nil {
+			t.Errorf("size-classes collected after %v, want after 250ms", time.Since(start))
+		}
+	}
+
+	time.Sleep(250*time.Millisecond - time.Since(start))
+	if series := pl.Collect(nil).Series; series["size-classes"] == nil {
+		t.Errorf("size-classes not collected after %v", time.Since(start))
+	}
+}
+
+func TestCollectPlots(t *testing.T) {
+	pl, err := NewList(nil, time.Second, nil, Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := pl.Collect(map[string]bool{"cgo": true}).Series
+	if len(series) != 2 || series["cgo"] == nil || series["lastgc"] == nil {
+		t.Errorf("got series %v, want cgo and lastgc only", slices.Collect(maps.Keys(series)))
+	}
+}
+
+func TestNewListIntervalErrors(t *testing.T) {
+	tests := map[string]map[string]time.Duration{
+		"unknown plot":      {"unknown": time.Second},
+		"reserved name":     {"lastgc": time.Second},
+		"negative interval": {"cgo": -time.Second},
+		"not a multiple":    {"cgo": 400 * time.Millisecond},
+	}
+	for name, intervals := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewList(nil, time.Second, intervals, Selection{}); err == nil {
+				t.Errorf("NewList() returned nil error")
+			}
+		})
+	}
+}
+
+func TestNewListSelection(t *testing.T) {
+	userPlots := []UserPlot{{Scatter: &ScatterUserPlot{
+		Plot:  Scatter{Name: "user"},
+		Funcs: []func() float64{func() float64 { return 1 }},
+	}}}
+	pl, err := NewList(userPlots, time.Second, nil, Selection{
+		Include: []string{"cgo", "goroutines", "gc-cycles"},
+		Exclude: []string{"gc-cycles"},
+		Order:   []string{"goroutines", "user"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, layout := range pl.Config().Series {
+		names = append(names, LayoutName(layout))
+	}
+	if want := []string{"goroutines", "user", "cgo"}; !slices.Equal(names, want) {
+		t.Errorf("plots = %v, want %v", names, want)
+	}
+	series := pl.Collect(nil).Series
+	if len(series) != 4 {
+		t.Errorf("got series %v, want the 3 plots and lastgc", slices.Collect(maps.Keys(series)))
+	}
+	// Only the metrics of the selected plots are read.
+	for i, s := range pl.samples {
+		used := s.Name == "/cgo/go-to-c-calls:calls" || strings.HasPrefix(s.Name, "/sched/goroutines")
+		if read := s.Value.Kind() != metrics.KindBad; read != used {
+			t.Errorf("metric %d %s read = %t, want %t", i, s.Name, read, used)
+		}
+	}
+}
+
+func TestNewListSelectionErrors(t *testing.T) {
+	tests := map[string]Selection{
+		"unknown include":    {Include: []string{"unknown"}},
+		"unknown exclude":    {Exclude: []string{"unknown"}},
+		"unknown order":      {Order: []string{"unknown"}},
+		"include reserved":   {Include: []string{"lastgc"}},
+		"order excluded":     {Exclude: []string{"cgo"}, Order: []string{"cgo"}},
+		"order not included": {Include: []string{"goroutines"}, Order: []string{"cgo"}},
+	}
+	for name, sel := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewList(nil, time.Second, nil, sel); err == nil {
+				t.Errorf("NewList() returned nil error")
+			}
+		})
+	}
+
+	t.Run("interval excluded", func(t *testing.T) {
+		intervals := map[string]time.Duration{"cgo": 2 * time.Second}
+		if _, err := NewList(nil, time.Second, intervals, Selection{Exclude: []string{"cgo"}}); err == nil {
+			t.Errorf("NewList() returned nil error")
+		}
+	})
+}
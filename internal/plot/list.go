@@ -1,9 +1,8 @@
 package plot
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
+	"maps"
 	"runtime/debug"
 	"runtime/metrics"
 	"slices"
@@ -12,18 +11,17 @@ import (
 )
 
 // IsReservedPlotName reports whether that name is reserved for Statsviz plots
-// and thus can't be used for a user plot.
+// and thus can't be used for a user plot. Reserved names are the same for all
+// Lists.
 func IsReservedPlotName(name string) bool {
 	if name == "timestamp" || name == "lastgc" {
 		return true
 	}
-	registry := reg()
-	return slices.ContainsFunc(registry.descriptions, func(pd description) bool {
-		return nameFromLayout(pd.layout) == name
-	})
+	return builtin.has(name)
 }
 
-func nameFromLayout(layout any) string {
+// LayoutName returns the name of the plot of a Scatter or Heatmap layout.
+func LayoutName(layout any) string {
 	switch layout := layout.(type) {
 	case Scatter:
 		return layout.Name
@@ -34,6 +32,10 @@ func nameFromLayout(layout any) string {
 	}
 }
 
+// Cumulative reports whether the bucket counts of the heatmap only ever
+// increase, as opposed to representing the current state of a distribution.
+func (h Heatmap) Cumulative() bool { return h.cumulative }
+
 // getvalues extracts, from a sample of runtime metrics, a slice with all
 // the metrics necessary for a single plot.
 type getvalues func(time.Time, []metrics.Sample) any
@@ -47,52 +49,206 @@ type List struct {
 	once sync.Once // ensure Config is built once
 	cfg  *Config
 
-	reg *registry
+	reg     *registry        // plots of the list, and the metrics they use
+	samples []metrics.Sample // last read values of the metrics used by plots
+
+	order []string // plots shown first, in this order
+
+	interval  time.Duration            // default collection interval
+	intervals map[string]time.Duration // collection interval of each plot
+	tick      time.Duration            // interval between collections
+	next      map[string]time.Time     // next collection time of each plot
+
+	mu       sync.Mutex           // protects last, lastTime, gcStats and numGC
+	last     map[string][]float64 // last collected values of each plot
+	lastTime time.Time
+	gcStats  debug.GCStats
+	numGC    int64 // number of garbage collections at the last call to Collect
 }
 
 type runtimePlot struct {
 	name    string
 	getvals getvalues
-	layout  any // Scatter | Heatmap
+	newvals func() getvalues // creates getvals, with a fresh state
+	layout  any              // Scatter | Heatmap
+	samples []int            // indices of the metrics used by the plot
 }
 
-func NewList(userPlots []UserPlot) (*List, error) {
+// Selection selects and orders the Statsviz plots of a List. The zero value
+// selects all plots, in their default order.
+type Selection struct {
+	Include []string // only these Statsviz plots are shown, if not empty
+	Exclude []string // these Statsviz plots are not shown
+	Order   []string // plots shown first, in this order, user plots included
+}
+
+// NewList creates the list of all plots selected by sel, user plots included.
+// Plots are collected at the default interval, unless intervals, indexed by
+// plot name, says otherwise or they declare their own interval. Every interval
+// must be a multiple of the shortest one.
+func NewList(userPlots []UserPlot, interval time.Duration, intervals map[string]time.Duration, sel Selection) (*List, error) {
 	if name := hasDuplicatePlotNames(userPlots); name != "" {
 		return nil, fmt.Errorf("duplicate plot name %s", name)
 	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("collection interval must be positive")
+	}
+
+	pl := &List{
+		reg:       newRegistry(),
+		userPlots: make([]UserPlot, len(userPlots)),
+		interval:  interval,
+		intervals: make(map[string]time.Duration),
+		next:      make(map[string]time.Time),
+	}
+	// User plots are copied since lists set their interval and collect them
+	// concurrently.
+	for i, up := range userPlots {
+		pl.userPlots[i] = up.clone()
+	}
+
+	isUserPlot := func(name string) bool {
+		return slices.ContainsFunc(userPlots, func(up UserPlot) bool {
+			return LayoutName(up.Layout()) == name
+		})
+	}
+	known := func(name string) bool {
+		return pl.reg.has(name) || isUserPlot(name)
+	}
+	for name, intv := range intervals {
+		if intv <= 0 {
+			return nil, fmt.Errorf("plot %s: collection interval must be positive", name)
+		}
+		if !known(name) {
+			return nil, fmt.Errorf("unknown plot %s", name)
+		}
+		pl.intervals[name] = intv
+	}
+	for _, up := range userPlots {
+		if up.interval() < 0 {
+			return nil, fmt.Errorf("plot %s: collection interval must be positive", LayoutName(up.Layout()))
+		}
+	}
+
+	for _, names := range [][]string{sel.Include, sel.Exclude} {
+		for _, name := range names {
+			if !pl.reg.has(name) {
+				return nil, fmt.Errorf("unknown plot %s", name)
+			}
+		}
+	}
+	for _, name := range sel.Order {
+		if !known(name) {
+			return nil, fmt.Errorf("unknown plot %s", name)
+		}
+	}
+	pl.order = sel.Order
+
+	// Plots that aren't shown are removed from the registry, so that their
+	// metrics aren't read.
+	pl.reg.descriptions = slices.DeleteFunc(pl.reg.descriptions, func(pd description) bool {
+		name := LayoutName(pd.layout)
+		return len(sel.Include) > 0 && !slices.Contains(sel.Include, name) || slices.Contains(sel.Exclude, name)
+	})
+	for _, name := range sel.Order {
+		if !known(name) {
+			return nil, fmt.Errorf("plot %s is ordered but not shown", name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(pl.intervals)) {
+		if !known(name) {
+			return nil, fmt.Errorf("plot %s has a collection interval but is not shown", name)
+		}
+	}
 
-	return &List{reg: reg(), userPlots: userPlots}, nil
+	for _, pd := range pl.reg.descriptions {
+		pl.setInterval(LayoutName(pd.layout), time.Duration(pd.interval)*interval)
+	}
+	for _, up := range userPlots {
+		pl.setInterval(LayoutName(up.Layout()), up.interval())
+	}
+
+	// Collect is called at the shortest interval, so the others must be
+	// multiples of it for plots to be collected on time.
+	pl.tick = interval
+	if len(pl.intervals) > 0 {
+		pl.tick = slices.Min(slices.Collect(maps.Values(pl.intervals)))
+	}
+	for _, name := range slices.Sorted(maps.Keys(pl.intervals)) {
+		if intv := pl.intervals[name]; intv%pl.tick != 0 {
+			return nil, fmt.Errorf("plot %s: collection interval %v is not a multiple of the shortest one, %v", name, intv, pl.tick)
+		}
+	}
+
+	return pl, nil
 }
 
 func (pl *List) enabledPlots() []runtimePlot {
 	plots := make([]runtimePlot, 0, len(pl.reg.descriptions))
 
 	for _, plot := range pl.reg.descriptions {
+		name := LayoutName(plot.layout)
+		intv := pl.layoutInterval(name)
+
 		var layout any
 		switch l := plot.layout.(type) {
 		case Scatter:
 			l.Metrics = plot.metrics
+			l.Interval = intv
 			layout = l
 		case Heatmap:
 			l.Metrics = plot.metrics
+			l.Interval = intv
 			layout = l
 		default:
 			layout = plot.layout
 		}
 
+		samples := make([]int, len(plot.metrics))
+		for i, m := range plot.metrics {
+			samples[i] = pl.reg.index(m)
+		}
+
 		plots = append(plots, runtimePlot{
-			name:    nameFromLayout(layout),
+			name:    name,
 			getvals: plot.getvalues(),
+			newvals: plot.getvalues,
 			layout:  layout,
+			samples: samples,
 		})
 	}
 
 	return plots
 }
 
+// setInterval records the collection interval of a plot declaring intv as its
+// own interval, 0 meaning the default interval, unless it's been overridden.
+func (pl *List) setInterval(name string, intv time.Duration) {
+	if _, ok := pl.intervals[name]; ok {
+		return
+	}
+	if intv == 0 {
+		intv = pl.interval
+	}
+	pl.intervals[name] = intv
+}
+
+// layoutInterval returns the collection interval of a plot in milliseconds, as
+// it's shown in its layout: 0 for the default interval.
+func (pl *List) layoutInterval(name string) int64 {
+	if intv := pl.intervals[name]; intv != pl.interval {
+		return intv.Milliseconds()
+	}
+	return 0
+}
+
 func (pl *List) Config() *Config {
 	pl.once.Do(func() {
 		pl.rtPlots = pl.enabledPlots()
+		pl.samples = make([]metrics.Sample, len(pl.reg.metrics))
+		for i := range pl.samples {
+			pl.samples[i].Name = pl.reg.metrics[i]
+		}
 
 		layouts := make([]any, len(pl.rtPlots))
 		for i := range pl.rtPlots {
@@ -106,63 +262,182 @@ func (pl *List) Config() *Config {
 
 		// User plots go at the back.
 		for i := range pl.userPlots {
-			pl.cfg.Series = append(pl.cfg.Series, pl.userPlots[i].Layout())
+			up := &pl.userPlots[i]
+			intv := pl.layoutInterval(LayoutName(up.Layout()))
+			switch {
+			case up.Scatter != nil:
+				up.Scatter.Plot.Interval = intv
+			case up.Heatmap != nil:
+				up.Heatmap.Plot.Interval = intv
+			}
+			pl.cfg.Series = append(pl.cfg.Series, up.Layout())
+		}
+
+		if len(pl.order) > 0 {
+			rank := func(layout any) int {
+				if i := slices.Index(pl.order, LayoutName(layout)); i != -1 {
+					return i
+				}
+				return len(pl.order)
+			}
+			slices.SortStableFunc(pl.cfg.Series, func(a, b any) int {
+				return rank(a) - rank(b)
+			})
 		}
 	})
 	return pl.cfg
 }
 
-// WriteTo writes into w a JSON object containing the data points for all plots
-// at the current instant. Return the number of written plots.
-func (pl *List) WriteTo(w io.Writer) (int64, error) {
-	samples := pl.reg.read()
+// Tick returns the interval at which Collect should be called, the shortest
+// collection interval of all plots.
+func (pl *List) Tick() time.Duration {
+	return pl.tick
+}
 
-	// lastgc time series is used as source to represent garbage collection
-	// timestamps as vertical bars on certain plots.
-	gcStats := debug.GCStats{}
-	debug.ReadGCStats(&gcStats)
+// Collect returns the data points of the plots that are due for collection at
+// the current instant, and the garbage collection events. Only the plots in
+// the given set are collected, or all of them if it's nil, and only the
+// metrics they use are read.
+func (pl *List) Collect(plots map[string]bool) *Frame {
+	pl.Config()
 
-	m := map[string]any{
-		// Javascript timestamps are in milliseconds.
-		"lastgc": []int64{gcStats.LastGC.UnixMilli()},
-	}
 	now := time.Now()
-	for _, p := range pl.rtPlots {
-		m[p.name] = p.getvals(now, samples)
+	var stale bool
+	due := func(name string) bool {
+		if plots != nil && !plots[name] {
+			return false
+		}
+		// Plots collected at every tick are always due, even if the previous
+		// tick came late. Tolerate some jitter of the ticks for the others.
+		next, ok := pl.next[name]
+		if ok && pl.intervals[name] > pl.tick && now.Add(pl.tick/2).Before(next) {
+			return false
+		}
+		// The plot was not collected for a while, because nobody was looking
+		// at it. Values derived from the previous collection would be wrong.
+		stale = ok && now.After(next.Add(pl.intervals[name]))
+		pl.next[name] = now.Add(pl.intervals[name])
+		return true
+	}
+
+	var (
+		rtPlots []*runtimePlot
+		idx     []int
+		needed  = make([]bool, len(pl.reg.metrics))
+	)
+	for i := range pl.rtPlots {
+		p := &pl.rtPlots[i]
+		if !due(p.name) {
+			continue
+		}
+		if stale {
+			p.getvals = p.newvals()
+		}
+		rtPlots = append(rtPlots, p)
+		for _, j := range p.samples {
+			if !needed[j] {
+				needed[j] = true
+				idx = append(idx, j)
+			}
+		}
+	}
+	samples := pl.read(idx, now)
+
+	// Plot values are copied since getvalues functions may reuse their buffers.
+	series := make(map[string][]float64, len(rtPlots)+len(pl.userPlots)+1)
+	series["lastgc"] = pl.gcEvents()
+
+	for _, p := range rtPlots {
+		series[p.name] = float64s(p.getvals(now, samples))
 	}
 
 	for i := range pl.userPlots {
 		up := &pl.userPlots[i]
 		switch {
 		case up.Scatter != nil:
+			if !due(up.Scatter.Plot.Name) {
+				continue
+			}
 			vals := make([]float64, len(up.Scatter.Funcs))
 			for i := range up.Scatter.Funcs {
 				vals[i] = up.Scatter.Funcs[i]()
 			}
-			m[up.Scatter.Plot.Name] = vals
+			series[up.Scatter.Plot.Name] = vals
 		case up.Heatmap != nil:
-			panic("unimplemented")
+			if !due(up.Heatmap.Plot.Name) {
+				continue
+			}
+			series[up.Heatmap.Plot.Name] = float64s(up.Heatmap.values())
 		}
 	}
 
-	type data struct {
-		Series    map[string]any `json:"series"`
-		Timestamp int64          `json:"timestamp"`
+	pl.mu.Lock()
+	last := maps.Clone(pl.last)
+	if last == nil {
+		last = make(map[string][]float64, len(series))
 	}
+	maps.Copy(last, series)
+	pl.last = last
+	pl.lastTime = now
+	pl.mu.Unlock()
+
+	return &Frame{Time: now, Series: series}
+}
 
-	if err := json.NewEncoder(w).Encode(struct {
-		Event string `json:"event"`
-		Data  data   `json:"data"`
-	}{
-		Event: "metrics",
-		Data: data{
-			Series:    m,
-			Timestamp: now.UnixMilli(),
-		},
-	}); err != nil {
-		return 0, fmt.Errorf("failed to write/convert metrics values to json: %v", err)
+// Last returns the values of all plots as of their last collection, and the
+// time of that collection. The returned map must not be modified.
+func (pl *List) Last() (time.Time, map[string][]float64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	return pl.lastTime, pl.last
+}
+
+// read only reads the metrics at the given indices, other samples keep their
+// previous values. Metrics are read through the shared sampler, so that other
+// Lists collecting at the same time don't read them again.
+func (pl *List) read(idx []int, now time.Time) []metrics.Sample {
+	shared.read(pl.samples, idx, now)
+	return pl.samples
+}
+
+// gcEvents returns the lastgc events time series, used as source to represent
+// garbage collections as vertical bars on certain plots. It holds, for each
+// garbage collection that ended since the last call, oldest first, its end
+// time followed by its pause duration, in seconds. Javascript timestamps are in
+// milliseconds.
+func (pl *List) gcEvents() []float64 {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	debug.ReadGCStats(&pl.gcStats)
+
+	// The pause history is limited, older collections are lost.
+	n := min(pl.gcStats.NumGC-pl.numGC, int64(len(pl.gcStats.PauseEnd)))
+	pl.numGC = pl.gcStats.NumGC
+
+	events := make([]float64, 0, 2*n)
+	for i := n - 1; i >= 0; i-- {
+		events = append(events,
+			float64(pl.gcStats.PauseEnd[i].UnixMilli()),
+			pl.gcStats.Pause[i].Seconds(),
+		)
 	}
+	return events
+}
 
-	nplots := int64(len(pl.rtPlots) + len(pl.userPlots))
-	return nplots, nil
+// float64s returns a copy of the given plot values, as float64.
+func float64s(vals any) []float64 {
+	switch vals := vals.(type) {
+	case []float64:
+		return slices.Clone(vals)
+	case []uint64:
+		ret := make([]float64, len(vals))
+		for i, v := range vals {
+			ret[i] = float64(v)
+		}
+		return ret
+	default:
+		panic(fmt.Sprintf("unexpected plot values type %T", vals))
+	}
 }
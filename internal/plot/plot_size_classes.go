@@ -10,6 +10,7 @@ var _ = register(description{
 		"/gc/heap/allocs-by-size:bytes",
 		"/gc/heap/frees-by-size:bytes",
 	},
+	interval: 5, // as often as the heatmap is redrawn
 	getvalues: func() getvalues {
 		var sizeClasses []uint64
 
@@ -9,6 +9,7 @@ var _ = register(description{
 	metrics: []string{
 		"/sched/pauses/stopping/gc:seconds",
 	},
+	interval: 5, // as often as the heatmap is redrawn
 	getvalues: func() getvalues {
 		histfactor := 0
 		counts := [maxBuckets]uint64{}
@@ -33,6 +34,7 @@ var _ = register(description{
 			Title:      "Stop-the-world Stopping Latencies (GC)",
 			Type:       "heatmap",
 			UpdateFreq: 5,
+			cumulative: true,
 			Colorscale: GreenShades,
 			Buckets:    floatseq(len(buckets)),
 			CustomData: buckets,
@@ -9,6 +9,7 @@ var _ = register(description{
 	metrics: []string{
 		"/sched/pauses/total/gc:seconds",
 	},
+	interval: 5, // as often as the heatmap is redrawn
 	getvalues: func() getvalues {
 		histfactor := 0
 		counts := [maxBuckets]uint64{}
@@ -33,6 +34,7 @@ var _ = register(description{
 			Title:      "Stop-the-world Pause Latencies (Total)",
 			Type:       "heatmap",
 			UpdateFreq: 5,
+			cumulative: true,
 			Colorscale: PinkShades,
 			Buckets:    floatseq(len(buckets)),
 			CustomData: buckets,
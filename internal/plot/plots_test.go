@@ -14,7 +14,7 @@ func TestUnusedRuntimeMetrics(t *testing.T) {
 	// This test just prints the metrics we're not using in any plot. It can't
 	// fail, it's informational.
 	used := make(map[string]bool)
-	for _, d := range reg().descriptions {
+	for _, d := range builtin.descriptions {
 		for _, m := range d.metrics {
 			used[m] = true
 		}
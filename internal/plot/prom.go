@@ -0,0 +1,172 @@
+package plot
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Exposition formats supported by WriteMetrics.
+const (
+	PrometheusFormat  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsFormat = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// WriteMetrics writes into w the values of all plots, as of their last
+// collection, in the Prometheus text exposition format or, if openMetrics is true,
+// in the OpenMetrics format.
+//
+// Each time series plot is a gauge metric family, with one 'series' label per
+// subplot. Each heatmap plot is an histogram, whose sum is estimated from the
+// bucket upper bounds. Heatmaps showing the current state of a distribution,
+// rather than cumulative counts, are exposed as gauge histograms in the
+// OpenMetrics format and, in the Prometheus text format which has no gauge
+// histograms, as a gauge with one 'le' label per bucket, holding the same
+// values as histogram buckets.
+func (pl *List) WriteMetrics(w io.Writer, openMetrics bool) error {
+	_, last := pl.Last()
+
+	bw := bufio.NewWriter(w)
+	for _, layout := range pl.Config().Series {
+		switch layout := layout.(type) {
+		case Scatter:
+			vals, ok := last[layout.Name]
+			if !ok {
+				continue
+			}
+			writeGauge(bw, layout, vals)
+		case Heatmap:
+			vals, ok := last[layout.Name]
+			if !ok {
+				continue
+			}
+			writeHistogram(bw, layout, vals, openMetrics)
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+
+	return bw.Flush()
+}
+
+func writeGauge(w *bufio.Writer, layout Scatter, vals []float64) {
+	name := metricName(layout.Name)
+	writeHeader(w, name, "gauge", layout.Title)
+	for i, sp := range layout.Subplots {
+		if i >= len(vals) {
+			break
+		}
+		w.WriteString(name)
+		w.WriteString(`{series="`)
+		w.WriteString(escapeLabel(sp.Name))
+		w.WriteString(`"} `)
+		w.WriteString(formatFloat(vals[i]))
+		w.WriteByte('\n')
+	}
+}
+
+func writeHistogram(w *bufio.Writer, layout Heatmap, vals []float64, openMetrics bool) {
+	name := metricName(layout.Name)
+	typ, bucket, sum, count := "histogram", "_bucket", "_sum", "_count"
+	switch {
+	case layout.cumulative:
+	case openMetrics:
+		typ, sum, count = "gaugehistogram", "_gsum", "_gcount"
+	default:
+		// The Prometheus text format has no gauge histograms, so buckets are
+		// exposed as a gauge, with the same le label.
+		typ, bucket = "gauge", ""
+	}
+	writeHeader(w, name, typ, layout.Title)
+
+	var total, estimate float64
+	for i, v := range vals {
+		total += v
+		// The sum is estimated from the bucket upper bounds. The last bucket
+		// upper bound is +Inf, but CustomData holds the value used to draw it.
+		if i < len(layout.CustomData) {
+			estimate += v * layout.CustomData[i]
+		}
+		if i == len(vals)-1 || i >= len(layout.CustomData) {
+			continue
+		}
+		w.WriteString(name)
+		w.WriteString(bucket)
+		w.WriteString(`{le="`)
+		w.WriteString(formatFloat(layout.CustomData[i]))
+		w.WriteString(`"} `)
+		w.WriteString(formatFloat(total))
+		w.WriteByte('\n')
+	}
+	w.WriteString(name)
+	w.WriteString(bucket)
+	w.WriteString(`{le="+Inf"} `)
+	w.WriteString(formatFloat(total))
+	w.WriteByte('\n')
+	if typ == "gauge" {
+		return
+	}
+	w.WriteString(name)
+	w.WriteString(sum)
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(estimate))
+	w.WriteByte('\n')
+	w.WriteString(name)
+	w.WriteString(count)
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(total))
+	w.WriteByte('\n')
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# TYPE ")
+	w.WriteString(name)
+	w.WriteByte(' ')
+	w.WriteString(typ)
+	w.WriteByte('\n')
+	if help != "" {
+		w.WriteString("# HELP ")
+		w.WriteString(name)
+		w.WriteByte(' ')
+		w.WriteString(escapeHelp(help))
+		w.WriteByte('\n')
+	}
+}
+
+// metricName converts a plot name into a valid metric name.
+func metricName(plot string) string {
+	var sb strings.Builder
+	sb.WriteString("statsviz_")
+	for _, r := range plot {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,119 @@
+package plot
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	userPlots := []UserPlot{
+		{Scatter: &ScatterUserPlot{
+			Plot: Scatter{
+				Name:     "user-scatter",
+				Title:    "User\nScatter",
+				Subplots: []Subplot{{Name: "a"}, {Name: `b"c`}},
+			},
+			Funcs: []func() float64{
+				func() float64 { return 1.5 },
+				func() float64 { return 1e21 },
+			},
+		}},
+		{Heatmap: NewHeatmapUserPlot(
+			Heatmap{Name: "user heatmap"},
+			[]float64{0, 1, 2, math.Inf(1)},
+			func() []uint64 { return []uint64{1, 2, 3} },
+		)},
+	}
+
+	pl, err := NewList(userPlots, time.Second, nil, Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl.Config()
+
+	// Nothing to write before the first update.
+	var buf bytes.Buffer
+	if err := pl.WriteMetrics(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("WriteMetrics() wrote %q before first update, want nothing", buf.String())
+	}
+
+	pl.Collect(nil)
+
+	t.Run("prometheus", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := pl.WriteMetrics(&buf, false); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+
+		for _, want := range []string{
+			"# TYPE statsviz_user_scatter gauge\n# HELP statsviz_user_scatter User\\nScatter\n",
+			"statsviz_user_scatter{series=\"a\"} 1.5\n",
+			"statsviz_user_scatter{series=\"b\\\"c\"} 1e+21\n",
+			// The Prometheus text format has no gauge histograms.
+			"# TYPE statsviz_user_heatmap gauge\n",
+			"statsviz_user_heatmap{le=\"1\"} 1\n",
+			"statsviz_user_heatmap{le=\"2\"} 3\n",
+			"statsviz_user_heatmap{le=\"+Inf\"} 6\n",
+			"# TYPE statsviz_runnable_time histogram\n",
+			"statsviz_runnable_time_sum ",
+			"statsviz_runnable_time_count ",
+			"# TYPE statsviz_goroutines gauge\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output doesn't contain %q\n\noutput:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, "statsviz_user_heatmap_") {
+			t.Errorf("gauge statsviz_user_heatmap shouldn't have histogram series\n\noutput:\n%s", out)
+		}
+		if strings.Contains(out, "# EOF") {
+			t.Errorf("prometheus output shouldn't contain # EOF")
+		}
+	})
+
+	t.Run("openmetrics", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := pl.WriteMetrics(&buf, true); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+
+		for _, want := range []string{
+			"# TYPE statsviz_user_heatmap gaugehistogram\n",
+			"statsviz_user_heatmap_bucket{le=\"2\"} 3\n",
+			"statsviz_user_heatmap_bucket{le=\"+Inf\"} 6\n",
+			// Estimated from the bucket upper bounds: 1×1 + 2×2 + 3×3.
+			"statsviz_user_heatmap_gsum 14\n",
+			"statsviz_user_heatmap_gcount 6\n",
+			"# TYPE statsviz_runnable_time histogram\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output doesn't contain %q\n\noutput:\n%s", want, out)
+			}
+		}
+		if !strings.HasSuffix(out, "# EOF\n") {
+			t.Errorf("openmetrics output should end with # EOF")
+		}
+	})
+}
+
+func TestMetricName(t *testing.T) {
+	tests := map[string]string{
+		"cgo":                "statsviz_cgo",
+		"garbage collection": "statsviz_garbage_collection",
+		"size-classes":       "statsviz_size_classes",
+		"Foo_Bar9":           "statsviz_Foo_Bar9",
+	}
+	for plot, want := range tests {
+		if got := metricName(plot); got != want {
+			t.Errorf("metricName(%q) = %q, want %q", plot, got, want)
+		}
+	}
+}
@@ -4,7 +4,6 @@ package plot
 import (
 	"runtime/metrics"
 	"slices"
-	"sync"
 )
 
 type tag = string
@@ -20,35 +19,61 @@ type description struct {
 	metrics []string
 	layout  any
 
+	// interval is the collection interval of the plot, as a number of default
+	// intervals. If zero, the plot is collected at the default interval.
+	interval int
+
 	// getvalues creates the state (support struct) for the plot.
 	getvalues func() getvalues
 }
 
+// registry holds plot descriptions and the runtime metrics they use. The
+// index of a metric in metrics is its index in the samples passed to the
+// getvalues functions.
 type registry struct {
-	allMetrics   map[string]bool // names of all known runtime/metrics metrics
 	metrics      []string
 	descriptions []description
-
-	samples []metrics.Sample // lazily built, only with the metrics we need
 }
 
-var reg = sync.OnceValue(func() *registry {
-	reg := &registry{
-		allMetrics: make(map[string]bool),
-	}
+// builtin is the registry of all Statsviz plots, filled at package
+// initialization and never modified afterwards. Lists get their own copy.
+var builtin = &registry{}
+
+// knownMetrics holds the names of all runtime/metrics metrics.
+var knownMetrics = func() map[string]bool {
+	known := make(map[string]bool)
 	for _, m := range metrics.All() {
-		reg.allMetrics[m.Name] = true
+		known[m.Name] = true
+	}
+	return known
+}()
+
+// newRegistry returns a copy of the builtin registry.
+func newRegistry() *registry {
+	return &registry{
+		metrics:      slices.Clone(builtin.metrics),
+		descriptions: slices.Clone(builtin.descriptions),
 	}
+}
 
-	return reg
-})
+// has reports whether the registry has a plot with that name.
+func (r *registry) has(name string) bool {
+	return slices.ContainsFunc(r.descriptions, func(pd description) bool {
+		return LayoutName(pd.layout) == name
+	})
+}
+
+// index returns the index of a metric, or -1 if no plot uses it.
+func (r *registry) index(metric string) int {
+	return slices.Index(r.metrics, metric)
+}
 
 func (r *registry) mustidx(metric string) int {
-	if !r.allMetrics[metric] {
+	if !knownMetrics[metric] {
 		panic(metric + ": unknown metric in " + goversion())
 	}
 
-	idx := slices.Index(r.metrics, metric)
+	idx := r.index(metric)
 	if idx == -1 {
 		r.metrics = append(r.metrics, metric)
 		idx = len(r.metrics) - 1
@@ -57,46 +82,32 @@ func (r *registry) mustidx(metric string) int {
 	return idx
 }
 
-func (r *registry) buildSamples() {
-	r.samples = make([]metrics.Sample, len(r.metrics))
-	for i := range r.samples {
-		r.samples[i].Name = r.metrics[i]
-	}
-}
-
-func (r *registry) read() []metrics.Sample {
-	if r.samples == nil {
-		r.buildSamples()
+func (r *registry) register(desc description) {
+	for _, metric := range desc.metrics {
+		r.mustidx(metric)
 	}
-	metrics.Read(r.samples)
 
-	return r.samples
-}
-
-func (r *registry) register(desc description) {
 	// Histograms need special handling.
 	type heatmapLayoutFunc = func(samples []metrics.Sample) Heatmap
 	if buildLayout, ok := desc.layout.(heatmapLayoutFunc); ok {
-		// Rebuild samples to include the required metrics.
-		r.buildSamples()
-		samples := r.read()
+		samples := make([]metrics.Sample, len(r.metrics))
+		for i := range samples {
+			samples[i].Name = r.metrics[i]
+		}
+		metrics.Read(samples)
 		desc.layout = buildLayout(samples)
 	}
 
 	r.descriptions = append(r.descriptions, desc)
-
-	for _, metric := range desc.metrics {
-		r.mustidx(metric)
-	}
 }
 
+// mustidx and register fill the builtin registry, at package initialization.
+
 func mustidx(metric string) int {
-	// TODO: adapter for refactoring: remove
-	return reg().mustidx(metric)
+	return builtin.mustidx(metric)
 }
 
 func register(desc description) struct{} {
-	// TODO: adapter for refactoring: remove
-	reg().register(desc)
+	builtin.register(desc)
 	return struct{}{}
 }
@@ -0,0 +1,64 @@
+package plot
+
+import (
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// shareWindow is how long the values of runtime metrics read for a List are
+// reused by other Lists.
+const shareWindow = 10 * time.Millisecond
+
+// sampler reads runtime metrics on behalf of all Lists, so that Lists
+// collecting at the same time, as do Servers sharing the same interval, share
+// a single metrics.Read.
+type sampler struct {
+	mu      sync.Mutex
+	samples []metrics.Sample // indexed like the builtin registry metrics
+	readAt  []time.Time      // when each sample was read
+}
+
+var shared sampler
+
+// read reads, into dst, the metrics at the given indices. Metrics that have
+// been read less than shareWindow ago aren't read again.
+//
+// Histograms are shared by all Lists, and must be treated as read-only.
+func (s *sampler) read(dst []metrics.Sample, idx []int, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.samples == nil {
+		s.samples = make([]metrics.Sample, len(builtin.metrics))
+		for i := range s.samples {
+			s.samples[i].Name = builtin.metrics[i]
+		}
+		s.readAt = make([]time.Time, len(s.samples))
+	}
+
+	var stale []int
+	for _, j := range idx {
+		if now.Sub(s.readAt[j]) >= shareWindow || now.Before(s.readAt[j]) {
+			stale = append(stale, j)
+		}
+	}
+
+	if len(stale) > 0 {
+		// Read into new samples, since metrics.Read reuses histograms, which
+		// Lists may still be looking at.
+		sub := make([]metrics.Sample, len(stale))
+		for i, j := range stale {
+			sub[i].Name = s.samples[j].Name
+		}
+		metrics.Read(sub)
+		for i, j := range stale {
+			s.samples[j] = sub[i]
+			s.readAt[j] = now
+		}
+	}
+
+	for _, j := range idx {
+		dst[j] = s.samples[j]
+	}
+}
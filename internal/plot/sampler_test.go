@@ -0,0 +1,32 @@
+package plot
+
+import (
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+func TestSamplerShare(t *testing.T) {
+	var s sampler
+	idx := []int{builtin.index("/cgo/go-to-c-calls:calls")}
+
+	now := time.Now()
+	dst1 := make([]metrics.Sample, len(builtin.metrics))
+	s.read(dst1, idx, now)
+	readAt := s.readAt[idx[0]]
+
+	// Reads close in time share the same values.
+	dst2 := make([]metrics.Sample, len(builtin.metrics))
+	s.read(dst2, idx, now.Add(shareWindow/2))
+	if s.readAt[idx[0]] != readAt {
+		t.Errorf("metric read again within the share window")
+	}
+	if dst2[idx[0]].Value.Uint64() != dst1[idx[0]].Value.Uint64() {
+		t.Errorf("got different values within the share window")
+	}
+
+	s.read(dst2, idx, now.Add(shareWindow))
+	if !s.readAt[idx[0]].After(readAt) {
+		t.Errorf("metric not read again after the share window")
+	}
+}
@@ -6,9 +6,21 @@ type (
 		Series []any `json:"series"`
 		// Events contains a list of 'events time series' names. Series with
 		// these names must be sent alongside other series. An event time series
-		// is just made of timestamps with no associated value, each of which
-		// gets plotted as a vertical line over another plot.
+		// is made of the events that occurred since the previous update, as
+		// pairs of timestamp and duration, each of which gets plotted as a
+		// vertical line over another plot.
 		Events []string `json:"events"`
+		// Streams contains the user event streams, whose events are sent
+		// separately, as annotations.
+		Streams []EventStream `json:"streams,omitempty"`
+	}
+
+	// EventStream is a stream of user events, shown as labeled vertical
+	// lines over some plots.
+	EventStream struct {
+		Name  string   `json:"name"`
+		Color string   `json:"color"`
+		Plots []string `json:"plots"` // all time series plots if empty
 	}
 
 	Scatter struct {
@@ -17,6 +29,7 @@ type (
 		Title      string        `json:"title"`
 		Type       string        `json:"type"`
 		UpdateFreq int           `json:"updateFreq"`
+		Interval   int64         `json:"interval,omitempty"` // collection interval in ms, 0 for the default
 		InfoText   string        `json:"infoText"`
 		Events     string        `json:"events"`
 		Layout     ScatterLayout `json:"layout"`
@@ -47,6 +60,7 @@ type (
 		Title      string          `json:"title"`
 		Type       string          `json:"type"`
 		UpdateFreq int             `json:"updateFreq"`
+		Interval   int64           `json:"interval,omitempty"` // collection interval in ms, 0 for the default
 		InfoText   string          `json:"infoText"`
 		Events     string          `json:"events"`
 		Layout     HeatmapLayout   `json:"layout"`
@@ -55,6 +69,10 @@ type (
 		CustomData []float64       `json:"custom_data"`
 		Hover      HeapmapHover    `json:"hover"`
 		Metrics    []string        `json:"metrics"`
+
+		// cumulative reports whether bucket counts only ever increase, as
+		// opposed to representing the current state of a distribution.
+		cumulative bool
 	}
 
 	HeatmapLayout struct {
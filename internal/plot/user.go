@@ -1,13 +1,72 @@
 package plot
 
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
 type ScatterUserPlot struct {
-	Plot  Scatter
-	Funcs []func() float64
+	Plot     Scatter
+	Funcs    []func() float64
+	Interval time.Duration // collection interval, 0 for the default
 }
 
 type HeatmapUserPlot struct {
-	Plot Heatmap
-	// TODO(arl): heatmap get value func
+	Plot     Heatmap
+	Func     func() []uint64
+	Interval time.Duration // collection interval, 0 for the default
+
+	hist   metrics.Float64Histogram // user histogram, counts are refreshed at each call to values.
+	factor int                      // downsampling factor
+	counts [maxBuckets]uint64       // downsampled counts
+}
+
+// NewHeatmapUserPlot creates a user heatmap plot from the given layout. buckets
+// are the histogram bucket boundaries, as in [metrics.Float64Histogram], and
+// fn returns the histogram counts. The histogram gets downsampled if it has
+// too many buckets. The heatmap buckets, custom data and y axis ticks are
+// derived from the boundaries.
+func NewHeatmapUserPlot(layout Heatmap, buckets []float64, fn func() []uint64) *HeatmapUserPlot {
+	hp := &HeatmapUserPlot{
+		Func: fn,
+		hist: metrics.Float64Histogram{
+			Counts:  make([]uint64, len(buckets)-1),
+			Buckets: buckets,
+		},
+		factor: downsampleFactor(len(buckets), maxBuckets),
+	}
+
+	bounds := downsampleBuckets(&hp.hist, hp.factor)
+	layout.Type = "heatmap"
+	layout.Buckets = floatseq(len(bounds))
+	layout.CustomData = bounds
+	layout.Layout.YAxis.TickMode = "array"
+	layout.Layout.YAxis.TickVals, layout.Layout.YAxis.TickText = heatmapTicks(bounds)
+	hp.Plot = layout
+
+	return hp
+}
+
+// values calls the user function and returns the downsampled histogram counts.
+// Missing counts are considered to be zero and extra counts are ignored.
+func (hp *HeatmapUserPlot) values() []uint64 {
+	clear(hp.hist.Counts)
+	copy(hp.hist.Counts, hp.Func())
+	return downsampleCounts(&hp.hist, hp.factor, hp.counts[:])
+}
+
+// heatmapTicks returns the y axis tick values and texts for a heatmap with the
+// given bucket boundaries, with at most 10 evenly spaced ticks.
+func heatmapTicks(bounds []float64) (vals, text []float64) {
+	const maxTicks = 10
+
+	step := max(1, int(math.Ceil(float64(len(bounds))/maxTicks)))
+	for i := 0; i < len(bounds); i += step {
+		vals = append(vals, float64(i))
+		text = append(text, bounds[i])
+	}
+	return vals, text
 }
 
 type UserPlot struct {
@@ -28,6 +87,32 @@ func (up UserPlot) Layout() any {
 	panic("unreachable")
 }
 
+// clone returns a copy of up that shares no mutable state with it, so that a
+// user plot can be collected by several lists.
+func (up UserPlot) clone() UserPlot {
+	if up.Scatter != nil {
+		sp := *up.Scatter
+		return UserPlot{Scatter: &sp}
+	}
+	return UserPlot{Heatmap: &HeatmapUserPlot{
+		Plot:     up.Heatmap.Plot,
+		Func:     up.Heatmap.Func,
+		Interval: up.Heatmap.Interval,
+		hist: metrics.Float64Histogram{
+			Counts:  make([]uint64, len(up.Heatmap.hist.Counts)),
+			Buckets: up.Heatmap.hist.Buckets,
+		},
+		factor: up.Heatmap.factor,
+	}}
+}
+
+func (up UserPlot) interval() time.Duration {
+	if up.Scatter != nil {
+		return up.Scatter.Interval
+	}
+	return up.Heatmap.Interval
+}
+
 func hasDuplicatePlotNames(userPlots []UserPlot) string {
 	names := map[string]bool{}
 	for _, p := range userPlots {
@@ -1,6 +1,12 @@
 package plot
 
-import "testing"
+import (
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
 
 func Test_hasDuplicatePlotNames(t *testing.T) {
 	tests := []struct {
@@ -59,3 +65,120 @@ func Test_hasDuplicatePlotNames(t *testing.T) {
 		})
 	}
 }
+
+func TestHeatmapUserPlot(t *testing.T) {
+	t.Run("no downsampling", func(t *testing.T) {
+		var counts []uint64
+		hp := NewHeatmapUserPlot(Heatmap{Name: "h"}, []float64{0, 1, 2, 3, math.Inf(1)}, func() []uint64 { return counts })
+
+		if want := []float64{1, 2, 3, 4}; !slices.Equal(hp.Plot.CustomData, want) {
+			t.Errorf("CustomData = %v, want %v", hp.Plot.CustomData, want)
+		}
+		if want := []float64{0, 1, 2, 3}; !slices.Equal(hp.Plot.Buckets, want) {
+			t.Errorf("Buckets = %v, want %v", hp.Plot.Buckets, want)
+		}
+
+		counts = []uint64{1, 2, 3, 4}
+		if got, want := hp.values(), []uint64{1, 2, 3, 4}; !slices.Equal(got, want) {
+			t.Errorf("values() = %v, want %v", got, want)
+		}
+
+		// Missing counts are zeroes.
+		counts = []uint64{5}
+		if got, want := hp.values(), []uint64{5, 0, 0, 0}; !slices.Equal(got, want) {
+			t.Errorf("values() = %v, want %v", got, want)
+		}
+
+		// Extra counts are ignored.
+		counts = []uint64{1, 1, 1, 1, 1, 1}
+		if got, want := hp.values(), []uint64{1, 1, 1, 1}; !slices.Equal(got, want) {
+			t.Errorf("values() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("downsampling", func(t *testing.T) {
+		buckets := floatseq(2*maxBuckets + 1)
+		counts := make([]uint64, 2*maxBuckets)
+		for i := range counts {
+			counts[i] = 1
+		}
+		hp := NewHeatmapUserPlot(Heatmap{Name: "h"}, buckets, func() []uint64 { return counts })
+
+		if len(hp.Plot.CustomData) > maxBuckets {
+			t.Errorf("len(CustomData) = %d, want <= %d", len(hp.Plot.CustomData), maxBuckets)
+		}
+		vals := hp.values()
+		if len(vals) != len(hp.Plot.CustomData) {
+			t.Errorf("len(values()) = %d, want %d", len(vals), len(hp.Plot.CustomData))
+		}
+		var sum uint64
+		for _, v := range vals {
+			sum += v
+		}
+		if sum != uint64(len(counts)) {
+			t.Errorf("sum(values()) = %d, want %d", sum, len(counts))
+		}
+	})
+}
+
+func TestSharedUserPlots(t *testing.T) {
+	userPlots := []UserPlot{
+		{Scatter: &ScatterUserPlot{
+			Plot:  Scatter{Name: "s"},
+			Funcs: []func() float64{func() float64 { return 1 }},
+		}},
+		{Heatmap: NewHeatmapUserPlot(Heatmap{Name: "h"}, []float64{0, 1, 2}, func() []uint64 { return []uint64{1, 2} })},
+	}
+
+	// Lists sharing the same user plots neither share their layout nor their
+	// collection state.
+	var lists []*List
+	for _, intervals := range []map[string]time.Duration{nil, {"s": 2 * time.Millisecond, "h": 2 * time.Millisecond}} {
+		pl, err := NewList(userPlots, time.Millisecond, intervals, Selection{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists = append(lists, pl)
+	}
+
+	intervals := func(pl *List) []int64 {
+		var ret []int64
+		for _, layout := range pl.Config().Series {
+			switch layout := layout.(type) {
+			case Scatter:
+				if layout.Name == "s" {
+					ret = append(ret, layout.Interval)
+				}
+			case Heatmap:
+				if layout.Name == "h" {
+					ret = append(ret, layout.Interval)
+				}
+			}
+		}
+		return ret
+	}
+	if got := intervals(lists[0]); !slices.Equal(got, []int64{0, 0}) {
+		t.Errorf("first list intervals = %v, want [0 0]", got)
+	}
+	if got := intervals(lists[1]); !slices.Equal(got, []int64{2, 2}) {
+		t.Errorf("second list intervals = %v, want [2 2]", got)
+	}
+	if userPlots[0].Scatter.Plot.Interval != 0 || userPlots[1].Heatmap.Plot.Interval != 0 {
+		t.Errorf("lists modified the user plots")
+	}
+
+	var wg sync.WaitGroup
+	for _, pl := range lists {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if f := pl.Collect(nil); f.Series["h"] != nil && !slices.Equal(f.Series["h"], []float64{1, 2}) {
+					t.Errorf("h = %v, want [1 2]", f.Series["h"])
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,4 +1,9 @@
-import { Plot, createVerticalLines } from "./plot.js";
+import {
+  Plot,
+  createVerticalLines,
+  createAlertRegions,
+  createAnnotationLines,
+} from "./plot.js";
 import Plotly from "plotly.js-cartesian-dist";
 
 function debounce(fn, delay) {
@@ -15,9 +20,11 @@ export default class PlotManager {
   #shapesCache;
   #lastGcEnabled;
   #staggerHandle = null;
+  #streams;
 
   constructor(config) {
     this.container = document.getElementById("plots");
+    this.#streams = new Map((config.streams ?? []).map((s) => [s.name, s]));
     this.plots = config.series.map((pd) => new Plot(pd));
     this.#shapesCache = new Map();
     this.#lastGcEnabled = null;
@@ -46,7 +53,7 @@ export default class PlotManager {
     });
   }
 
-  update(data, gcEnabled, timeRange, force = false) {
+  update(data, gcEnabled, hiddenStreams, timeRange, force = false) {
     // Create GC vertical lines - only if needed.
     const shapes = new Map();
     if (gcEnabled) {
@@ -61,7 +68,7 @@ export default class PlotManager {
           cached.length !== serie.length ||
           (serie.length > 0 &&
             cached[cached.length - 1]?.x0?.getTime() !==
-              serie[serie.length - 1]?.getTime());
+              serie[serie.length - 1]?.ts.getTime());
 
         if (gcStateChanged || eventsChanged || !this.#shapesCache.has(name)) {
           const newShapes = createVerticalLines(serie);
@@ -81,9 +88,25 @@ export default class PlotManager {
     this.#lastGcEnabled = gcEnabled;
 
     // X-axis range.
-    const now = data.times[data.times.length - 1];
+    const now = data.now;
     const xrange = [now - timeRange * 1000, now];
 
+    // Alert regions and user events, by plot name.
+    const overlays = createAlertRegions(data.alerts, now);
+    const annotations = data.annotations.filter(
+      (a) => !hiddenStreams.has(a.stream)
+    );
+    const allPlots = this.plots
+      .filter((p) => !p.isHeatmap())
+      .map((p) => p.name());
+    for (const [name, lines] of createAnnotationLines(
+      annotations,
+      this.#streams,
+      allPlots
+    )) {
+      overlays.set(name, (overlays.get(name) ?? []).concat(lines));
+    }
+
     // Cancel any pending update to avoid overlapping updates
     if (this.#staggerHandle !== null) {
       cancelAnimationFrame(this.#staggerHandle);
@@ -97,7 +120,7 @@ export default class PlotManager {
       const start = performance.now();
       // Process plots for up to 12ms per frame to leave time for UI
       while (index < visiblePlots.length && performance.now() - start < 12) {
-        visiblePlots[index].update(xrange, data, shapes, force);
+        visiblePlots[index].update(xrange, data, shapes, overlays, force);
         index++;
       }
 
@@ -30,8 +30,29 @@ export default class RingBuffer {
     return result;
   }
 
+  // Returns the number of items, at the end, greater than or equal to min. Items
+  // must be in increasing order.
+  countFrom(min) {
+    let lo = 0;
+    let hi = this.#size;
+    while (lo < hi) {
+      const mid = (lo + hi) >> 1;
+      if (this.#buf[(this.#start + mid) % this.#buf.length] < min) {
+        lo = mid + 1;
+      } else {
+        hi = mid;
+      }
+    }
+    return this.#size - lo;
+  }
+
   get first() {
     if (this.#size === 0) return undefined;
     return this.#buf[this.#start];
   }
+
+  get last() {
+    if (this.#size === 0) return undefined;
+    return this.#buf[(this.#start + this.#size - 1) % this.#buf.length];
+  }
 }
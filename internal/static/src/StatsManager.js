@@ -1,10 +1,15 @@
 import RingBuffer from "./RingBuffer.js";
 
+// Maximum number of data points kept per plot, whatever its interval.
+const maxPoints = 4 * 600;
+
 export default class StatsManager {
   #retention;
-  #times;
+  #now = 0;
   #plotData;
   #eventsData;
+  #alerts = [];
+  #annotations = [];
 
   constructor(retentionSeconds, config) {
     this.#retention = retentionSeconds;
@@ -12,15 +17,25 @@ export default class StatsManager {
   }
 
   #initBuffers(config) {
-    const cap = this.#retention;
-    this.#times = new RingBuffer(cap);
+    this.#now = 0;
     this.#plotData = new Map();
     this.#eventsData = new Map();
 
     for (const pd of config.series) {
+      // Plots are collected at their own interval, if any, so each has its
+      // own timestamps, and enough room for the retention period. Plots
+      // collected at the default interval keep one point per second.
+      const cap = pd.interval
+        ? Math.min(
+            Math.ceil((this.#retention * 1000) / pd.interval),
+            maxPoints
+          )
+        : this.#retention;
       let dims = pd.type === "heatmap" ? pd.buckets.length : pd.subplots.length;
-      const arr = Array.from({ length: dims }, () => new RingBuffer(cap));
-      this.#plotData.set(pd.name, arr);
+      this.#plotData.set(pd.name, {
+        times: new RingBuffer(cap),
+        buffers: Array.from({ length: dims }, () => new RingBuffer(cap)),
+      });
     }
     for (const evt of config.events) {
       this.#eventsData.set(evt, []);
@@ -28,35 +43,59 @@ export default class StatsManager {
   }
 
   pushData(payload) {
-    this.#times.push(payload.timestamp);
+    this.#now = payload.timestamp;
 
-    for (const [name, buffers] of this.#plotData) {
+    // Messages only contain the plots that were due for collection.
+    for (const [name, { times, buffers }] of this.#plotData) {
       const values = payload.series[name];
+      if (!values) continue;
+      times.push(payload.timestamp);
       values.forEach((v, i) => buffers[i].push(v));
     }
 
+    // Events are sent as pairs of timestamp and duration, in seconds. Older
+    // recordings only have the timestamp of the last event, repeated.
+    const oldest = payload.timestamp - this.#retention * 1000;
     for (const [evtName, arr] of this.#eventsData) {
-      const raw = payload.series[evtName][0];
-      const ts = new Date(Math.floor(raw));
-      if (!arr.length || ts.getTime() !== arr[arr.length - 1].getTime()) {
-        arr.push(ts);
-        // drop old events
-        const oldest = this.#times.first;
-        if (arr[0] < oldest) arr.shift();
+      const raw = payload.series[evtName] ?? [];
+      for (let i = 0; i < raw.length; i += 2) {
+        const ts = new Date(Math.floor(raw[i]));
+        if (arr.length && ts <= arr[arr.length - 1].ts) continue;
+        arr.push({ ts, duration: raw[i + 1] });
       }
+      // drop old events
+      while (arr.length && arr[0].ts < oldest) arr.shift();
     }
   }
 
-  slice(lastN) {
-    const times = this.#times.slice(lastN);
+  // Sets the alert regions, as sent by the server.
+  setAlerts(alerts) {
+    this.#alerts = alerts;
+  }
+
+  // Sets the user events of all streams, as sent by the server.
+  setAnnotations(annotations) {
+    this.#annotations = annotations;
+  }
+
+  // Returns the data points of the last given number of seconds.
+  slice(seconds) {
+    const from = this.#now - seconds * 1000;
     const series = new Map();
-    for (const [name, buffers] of this.#plotData) {
-      series.set(
-        name,
-        buffers.map((buf) => buf.slice(lastN))
-      );
+    for (const [name, { times, buffers }] of this.#plotData) {
+      const n = times.countFrom(from);
+      series.set(name, {
+        times: times.slice(n),
+        values: buffers.map((buf) => buf.slice(n)),
+      });
     }
-    return { times, series, events: this.#eventsData };
+    return {
+      now: this.#now,
+      series,
+      events: this.#eventsData,
+      alerts: this.#alerts,
+      annotations: this.#annotations,
+    };
   }
 
   reset(config) {
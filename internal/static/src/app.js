@@ -1,12 +1,23 @@
 import StatsManager from "./StatsManager.js";
 import PlotManager from "./PlotManager.js";
-import { initNav, running, gcEnabled, timerange } from "./nav.js";
+import {
+  initNav,
+  initStreams,
+  initTags,
+  showDropped,
+  showStopped,
+  running,
+  gcEnabled,
+  hiddenStreams,
+  timerange,
+} from "./nav.js";
 import { buildWebsocketURI } from "./utils.js";
 import WebSocketClient from "./socket.js";
 import "bootstrap/dist/js/bootstrap.min.js";
 
 export let statsMgr;
 export let plotMgr;
+let wsClient;
 
 // RAF-based throttling for plot updates
 let rafId = null;
@@ -18,9 +29,18 @@ const scheduleUpdate = () => {
 
   rafId = requestAnimationFrame(() => {
     rafId = null;
+    wsClient.subscribe(
+      plotMgr.plots.filter((p) => p.isVisible()).map((p) => p.name())
+    );
     if (pendingUpdate && running) {
       const data = statsMgr.slice(timerange);
-      plotMgr.update(data, gcEnabled, timerange, forceNextUpdate);
+      plotMgr.update(
+        data,
+        gcEnabled,
+        hiddenStreams,
+        timerange,
+        forceNextUpdate
+      );
       pendingUpdate = false;
       forceNextUpdate = false;
     }
@@ -38,21 +58,39 @@ export const drawPlots = (force) => {
 export const connect = () => {
   const uri = buildWebsocketURI();
 
-  new WebSocketClient(
+  wsClient = new WebSocketClient(
     uri,
     // onConfig
     (cfg) => {
       plotMgr = new PlotManager(cfg);
       statsMgr = new StatsManager(600, cfg);
 
+      initTags(cfg.series);
       initNav(() => {
         drawPlots(false);
       });
+      initStreams(cfg.streams ?? [], drawPlots);
     },
     // onData
     (msg) => {
       statsMgr.pushData(msg);
       drawPlots(true);
+    },
+    // onEvent
+    (event, data) => {
+      if (event === "alerts") {
+        statsMgr.setAlerts(data.alerts);
+        drawPlots(true);
+      } else if (event === "annotations") {
+        statsMgr.setAnnotations(data.annotations);
+        drawPlots(true);
+      } else if (event === "dropped") {
+        showDropped(data.frames);
+      }
+    },
+    // onStopped
+    () => {
+      showStopped(() => wsClient.reconnect());
     }
   );
 };
@@ -0,0 +1,101 @@
+import { statsMgr, plotMgr } from "./app.js";
+import { timerange } from "./nav.js";
+
+// Returns the unit of a time series, the suffix of its d3-format string.
+const seriesUnit = (unitfmt) =>
+  unitfmt ? unitfmt.slice(unitfmt.lastIndexOf("}") + 1) : "";
+
+// Returns the unit of the bucket boundaries of a heatmap.
+const bucketUnit = (yunit) =>
+  ({ duration: "s", bytes: "B" })[yunit] ?? yunit ?? "";
+
+// Returns the columns of a plot, one per time series or heatmap bucket. Heatmap
+// columns are named after their bucket upper bound.
+const columns = (cfg) =>
+  cfg.type === "heatmap"
+    ? cfg.custom_data.map((b) => ({
+        name: `${b}`,
+        unit: bucketUnit(cfg.hover.yunit),
+      }))
+    : cfg.subplots.map((sp) => ({
+        name: sp.name,
+        unit: seriesUnit(sp.unitfmt),
+      }));
+
+// Returns the data of a plot as an object, with one row of values per
+// timestamp, in milliseconds since the Unix epoch.
+const plotJSON = (cfg, { times, values }) => {
+  const json = { name: cfg.name, title: cfg.title, type: cfg.type };
+  if (cfg.type === "heatmap") {
+    json.buckets = [...cfg.custom_data];
+    json.unit = bucketUnit(cfg.hover.yunit);
+  } else {
+    json.series = columns(cfg);
+  }
+  json.times = Array.from(times);
+  json.values = json.times.map((_, i) => values.map((v) => v[i]));
+  return json;
+};
+
+const csvField = (s) =>
+  /[",\n\r]/.test(s) ? `"${s.replaceAll('"', '""')}"` : s;
+
+// Returns the data of the plots as CSV, with one row per timestamp, in
+// milliseconds since the Unix epoch, and one column per time series or heatmap
+// bucket, named plot/series or plot/bound, followed by the unit. Cells of plots
+// that weren't collected at a given time are empty.
+const plotsCSV = (cfgs, series) => {
+  const header = ["time"];
+  const rows = new Map(); // by timestamp
+  for (const cfg of cfgs) {
+    const { times, values } = series.get(cfg.name);
+    const start = header.length;
+    for (const col of columns(cfg)) {
+      const unit = col.unit ? ` (${col.unit})` : "";
+      header.push(`${cfg.name}/${col.name}${unit}`);
+    }
+    times.forEach((t, i) => {
+      if (!rows.has(t)) rows.set(t, [t]);
+      const row = rows.get(t);
+      values.forEach((v, j) => (row[start + j] = v[i]));
+    });
+  }
+
+  const lines = [header.map(csvField).join(",")];
+  for (const t of [...rows.keys()].sort((a, b) => a - b)) {
+    const row = rows.get(t);
+    lines.push(Array.from(header, (_, i) => row[i] ?? "").join(","));
+  }
+  return lines.join("\n") + "\n";
+};
+
+const save = (filename, type, content) => {
+  const url = URL.createObjectURL(new Blob([content], { type }));
+  const a = document.createElement("a");
+  a.href = url;
+  a.download = filename;
+  a.click();
+  setTimeout(() => URL.revokeObjectURL(url), 0);
+};
+
+// Downloads, as "csv" or "json", the data of the plots currently shown on the
+// selected time range: that of the named plot or, if name is null, of all
+// visible plots.
+export const downloadData = (name, format) => {
+  const plots = plotMgr.plots.filter((p) =>
+    name === null ? p.isVisible() : p.name() === name
+  );
+  const cfgs = plots.map((p) => p.config());
+  const { series } = statsMgr.slice(timerange);
+
+  const base =
+    name === null ? "statsviz" : `statsviz-${name.replace(/[^\w.-]+/g, "_")}`;
+  if (format === "csv") {
+    save(`${base}.csv`, "text/csv", plotsCSV(cfgs, series));
+  } else {
+    const json = {
+      plots: cfgs.map((cfg) => plotJSON(cfg, series.get(cfg.name))),
+    };
+    save(`${base}.json`, "application/json", JSON.stringify(json));
+  }
+};
@@ -1,6 +1,7 @@
 import { Tooltip } from "bootstrap";
 import { connect } from "./app.js";
 import * as theme from "./theme.js";
+import { tooltipOptions } from "./utils.js";
 import "bootstrap/dist/css/bootstrap.min.css";
 import "./style.css";
 
@@ -8,10 +9,5 @@ connect();
 theme.updateThemeMode();
 
 document.querySelectorAll('[data-bs-toggle="tooltip"]').forEach((el) => {
-  new Tooltip(el, {
-    trigger: "hover focus",
-    delay: { show: 700, hide: 100 },
-    animation: true,
-    placement: "bottom",
-  });
+  new Tooltip(el, tooltipOptions);
 });
@@ -1,10 +1,118 @@
+import { Tooltip } from "bootstrap";
 import * as theme from "./theme.js";
 import { plotMgr } from "./app.js";
+import { tooltipOptions } from "./utils.js";
+import { downloadData } from "./download.js";
 
 export let running = true;
 export let gcEnabled = true;
 export let timerange = 60;
 
+// Categories of the Statsviz plots, in the order of their toggles, and their
+// labels. Categories of user plots follow, labeled with their name.
+const builtinTags = ["cpu", "gc", "scheduler", "misc"];
+const tagLabels = {
+  cpu: "CPU",
+  gc: "GC",
+  scheduler: "Scheduler",
+  misc: "Misc",
+};
+
+// Creates a toggle for each category of the given plots.
+export function initTags(series) {
+  const tags = new Set(
+    builtinTags.filter((tag) => series.some((s) => s.tags?.includes(tag)))
+  );
+  series.forEach((s) => s.tags?.forEach((tag) => tags.add(tag)));
+
+  const container = document.getElementById("plot-tags");
+  container.replaceChildren();
+
+  [...tags].forEach((tag, i) => {
+    const input = document.createElement("input");
+    input.type = "checkbox";
+    input.className = "btn-check";
+    input.id = `tag-${i}`;
+    input.dataset.tag = tag;
+    input.autocomplete = "off";
+
+    const label = document.createElement("label");
+    label.className = "btn btn-sm btn-outline-secondary";
+    label.htmlFor = input.id;
+    label.title = "Alt+Click to show only this category";
+    label.textContent = tagLabels[tag] ?? tag;
+    new Tooltip(label, tooltipOptions);
+
+    container.append(input, label);
+  });
+}
+
+// Names of the user event streams hidden by the user.
+export const hiddenStreams = new Set();
+
+// Creates a show/hide toggle for each of the user event streams.
+export function initStreams(streams, onUpdate) {
+  const container = document.getElementById("event-streams");
+  container.replaceChildren();
+
+  streams.forEach((stream, i) => {
+    const input = document.createElement("input");
+    input.type = "checkbox";
+    input.className = "btn-check";
+    input.id = `btn-stream-${i}`;
+    input.autocomplete = "off";
+    input.checked = !hiddenStreams.has(stream.name);
+    input.addEventListener("change", () => {
+      if (input.checked) {
+        hiddenStreams.delete(stream.name);
+      } else {
+        hiddenStreams.add(stream.name);
+      }
+      onUpdate(true);
+    });
+
+    const label = document.createElement("label");
+    label.className = "btn btn-sm btn-outline-secondary";
+    label.htmlFor = input.id;
+    label.title = `Show/hide ${stream.name} events`;
+    const icon = document.createElement("i");
+    icon.className = "bi bi-flag-fill";
+    icon.style.color = stream.color;
+    label.append(icon, ` ${stream.name}`);
+
+    container.append(input, label);
+  });
+}
+
+let droppedFrames = 0;
+let droppedTimer = null;
+
+// Shows how many metrics updates the server dropped because the connection
+// was too slow. The indicator is hidden after a while without drops.
+export function showDropped(frames) {
+  const badge = document.getElementById("dropped-frames");
+  droppedFrames += frames;
+  badge.textContent = `${droppedFrames} updates dropped`;
+  badge.hidden = false;
+
+  clearTimeout(droppedTimer);
+  droppedTimer = setTimeout(() => {
+    droppedFrames = 0;
+    badge.hidden = true;
+  }, 10000);
+}
+
+// Shows that the server was stopped. onReconnect is called when the user asks
+// to connect again.
+export function showStopped(onReconnect) {
+  const btn = document.getElementById("server-stopped");
+  btn.hidden = false;
+  btn.onclick = () => {
+    btn.hidden = true;
+    onReconnect();
+  };
+}
+
 export function updateVisibility() {
   const tagInputs = Array.from(
     document.querySelectorAll("#navCategories input[data-tag]")
@@ -43,6 +151,11 @@ export function initNav(onUpdate) {
     onUpdate(true);
   });
 
+  // Download the data of the visible plots.
+  document.querySelectorAll("#download-data [data-format]").forEach((item) => {
+    item.onclick = () => downloadData(null, item.dataset.format);
+  });
+
   // Dark mode toggle.
   const themebtn = document.getElementById("btn-darkmode");
   themebtn.addEventListener("change", (e) => {
@@ -5,7 +5,7 @@ import {
   newLayoutObject,
   themeColors,
 } from "./plotConfig.js";
-import { formatFunction } from "./utils.js";
+import { formatDuration, formatFunction } from "./utils.js";
 import Plotly from "plotly.js-cartesian-dist";
 import tippy, { followCursor } from "tippy.js";
 import "tippy.js/dist/tippy.css";
@@ -68,8 +68,16 @@ class Plot {
     return this.#cfg.name;
   }
 
+  config() {
+    return this.#cfg;
+  }
+
+  isHeatmap() {
+    return this.#cfg.type == "heatmap";
+  }
+
   hasTag(tag) {
-    return this.#cfg.tags.includes(tag);
+    return this.#cfg.tags?.includes(tag) ?? false;
   }
 
   matches(query) {
@@ -163,7 +171,13 @@ class Plot {
     </div>
 </div> `;
       };
-      instance.setContent(data.points.map(pt2txt)[0]);
+      // Ignore points of the events markers trace.
+      const points = data.points.filter((d) => d.data.type == "heatmap");
+      if (!points.length) {
+        instance.hide();
+        return;
+      }
+      instance.setContent(points.map(pt2txt)[0]);
       instance.show();
     };
     const onUnhover = (_data) => {
@@ -173,18 +187,18 @@ class Plot {
     this.#htmlElt.on("plotly_hover", onHover).on("plotly_unhover", onUnhover);
   }
 
-  #extractData(data) {
-    const serie = data.series.get(this.#cfg.name);
+  #extractData(data, events) {
+    const { times, values } = data.series.get(this.#cfg.name);
 
     if (this.#cfg.type == "heatmap") {
-      this.#dataTemplate[0].x = data.times;
-      this.#dataTemplate[0].z = serie;
+      this.#dataTemplate[0].x = times;
+      this.#dataTemplate[0].z = values;
       this.#dataTemplate[0].hoverinfo = "none";
       this.#dataTemplate[0].colorbar = { len: "350", lenmode: "pixels" };
     } else {
       for (let i = 0; i < this.#dataTemplate.length; i++) {
-        this.#dataTemplate[i].x = data.times;
-        this.#dataTemplate[i].y = serie[i];
+        this.#dataTemplate[i].x = times;
+        this.#dataTemplate[i].y = values[i];
 
         this.#dataTemplate[i].stackgroup = this.#cfg.subplots[i].stackgroup;
         this.#dataTemplate[i].hoveron = this.#cfg.subplots[i].hoveron;
@@ -195,21 +209,35 @@ class Plot {
         };
       }
     }
-    return this.#dataTemplate;
+    if (!events.length) {
+      return this.#dataTemplate;
+    }
+    return [...this.#dataTemplate, eventMarkers(events)];
   }
 
-  update(xrange, data, shapes, force) {
-    this.#lastData = this.#extractData(data);
+  update(xrange, data, shapes, overlays, force) {
+    // Events are only shown if their vertical lines are.
+    const events =
+      (shapes.has(this.#cfg.events) && data.events.get(this.#cfg.events)) ||
+      [];
+    this.#lastData = this.#extractData(data, events);
     this.#updateCount++;
     if (
       force ||
       this.#cfg.updateFreq == 0 ||
       this.#updateCount % this.#cfg.updateFreq == 0
     ) {
-      // Update layout with vertical shapes if necessary.
+      // Update layout with vertical shapes, alert regions and user events
+      // if necessary.
+      let plotShapes = [];
       if (this.#cfg.events != "") {
-        this.#plotlyLayout.shapes = shapes.get(this.#cfg.events);
+        plotShapes = shapes.get(this.#cfg.events) ?? [];
       }
+      const extra = overlays.get(this.#cfg.name);
+      if (extra) {
+        plotShapes = plotShapes.concat(extra);
+      }
+      this.#plotlyLayout.shapes = plotShapes;
 
       // Move the xaxis time range.
       this.#plotlyLayout.xaxis.range = xrange;
@@ -305,11 +333,11 @@ class Plot {
   }
 }
 
-// Create 'vertical lines' shapes for each of the given timestamps.
-const createVerticalLines = (tss) => {
+// Create 'vertical lines' shapes for each of the given events.
+const createVerticalLines = (events) => {
   const shapes = [];
-  for (let i = 0, n = tss.length; i < n; i++) {
-    const d = tss[i];
+  for (let i = 0, n = events.length; i < n; i++) {
+    const d = events[i].ts;
     shapes.push({
       type: "line",
       x0: d,
@@ -327,4 +355,95 @@ const createVerticalLines = (tss) => {
   return shapes;
 };
 
-export { createVerticalLines, Plot };
+// Create a trace with a marker at the top of each event vertical line, showing
+// the event duration on hover.
+const eventMarkers = (events) => {
+  return {
+    type: "scatter",
+    mode: "markers",
+    x: events.map((e) => e.ts),
+    y: events.map(() => 1),
+    yaxis: "y2",
+    customdata: events.map((e) =>
+      e.duration === undefined ? "unknown" : formatDuration(e.duration)
+    ),
+    hovertemplate: "GC pause: %{customdata}<extra></extra>",
+    marker: {
+      symbol: "triangle-down",
+      size: 8,
+      color: "rgb(55, 128, 191)",
+    },
+    cliponaxis: false,
+    showlegend: false,
+  };
+};
+
+// Create 'rectangle' shapes for each of the given alert regions, grouped by
+// plot name. Regions of firing alerts extend up to now.
+const createAlertRegions = (alerts, now) => {
+  const regions = new Map();
+  for (const alert of alerts) {
+    const shape = {
+      type: "rect",
+      xref: "x",
+      yref: "paper",
+      x0: new Date(alert.start),
+      x1: new Date(alert.end || now),
+      y0: 0,
+      y1: 1,
+      fillcolor: alert.color,
+      line: { width: 0 },
+      layer: "below",
+      label: {
+        text: alert.name,
+        textposition: "top left",
+        font: { size: 10 },
+      },
+    };
+    if (!regions.has(alert.plot)) regions.set(alert.plot, []);
+    regions.get(alert.plot).push(shape);
+  }
+  return regions;
+};
+
+// Create labeled 'vertical lines' shapes for each of the given user events,
+// grouped by plot name. Events of streams not restricted to some plots are
+// shown on allPlots.
+const createAnnotationLines = (annotations, streams, allPlots) => {
+  const lines = new Map();
+  for (const a of annotations) {
+    const stream = streams.get(a.stream);
+    if (!stream) continue;
+
+    const d = new Date(a.time);
+    const shape = {
+      type: "line",
+      x0: d,
+      x1: d,
+      yref: "paper",
+      y0: 0,
+      y1: 1,
+      line: { color: stream.color, width: 2 },
+      label: {
+        text: a.label,
+        textposition: "end",
+        textangle: 0,
+        xanchor: "left",
+        font: { size: 10, color: stream.color },
+      },
+    };
+    const plots = stream.plots?.length ? stream.plots : allPlots;
+    for (const name of plots) {
+      if (!lines.has(name)) lines.set(name, []);
+      lines.get(name).push(shape);
+    }
+  }
+  return lines;
+};
+
+export {
+  createVerticalLines,
+  createAlertRegions,
+  createAnnotationLines,
+  Plot,
+};
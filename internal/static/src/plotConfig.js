@@ -37,6 +37,12 @@ export const newConfigObject = (cfg, isMaximized) => {
         icon: isMaximized ? Plotly.Icons.zoom_minus : Plotly.Icons.zoom_plus,
         click: ui.onClickPlotMaximize(cfg),
       },
+      {
+        name: "download",
+        title: "Download data as CSV or JSON",
+        icon: Plotly.Icons.disk,
+        click: ui.onClickPlotDownload(cfg),
+      },
     ],
     toImageButtonOptions: {
       format: "png",
@@ -103,6 +109,16 @@ export const newLayoutObject = (cfg, isMaximized) => {
     },
   };
 
+  if (cfg.events) {
+    // Hidden axis for the events markers, at the top of the plot.
+    layout.yaxis2 = {
+      overlaying: "y",
+      range: [0, 1],
+      visible: false,
+      fixedrange: true,
+    };
+  }
+
   if (layout.yaxis.tickmode == "array") {
     // Format yaxis ticks
     const formatYUnit = formatFunction(cfg.hover.yunit);
@@ -1,27 +1,69 @@
 import { clamp } from "./utils.js";
 
+// Websocket subprotocol for metrics sent in the packed binary format.
+const packedProtocol = "statsviz.packed.v1";
+
+// Close code sent by the server when it's shut down.
+const goingAway = 1001;
+
+// Decodes a packed metrics message: a sequence of little-endian float64, the
+// timestamp first, then, for each event and plot in configuration order, the
+// number of values followed by the values. A negative count means the message
+// has no values for that event or plot.
+export const unpack = (buf, names) => {
+  const view = new DataView(buf);
+  let off = 0;
+  const next = () => {
+    const v = view.getFloat64(off, true);
+    off += 8;
+    return v;
+  };
+
+  const timestamp = next();
+  const series = {};
+  for (const name of names) {
+    const n = next();
+    if (n < 0) continue;
+    const values = new Array(n);
+    for (let i = 0; i < n; i++) values[i] = next();
+    series[name] = values;
+  }
+  return { timestamp, series };
+};
+
 export default class WebSocketClient {
   #uri;
   #timeout;
   #onConfig;
   #onData;
+  #onEvent;
+  #onStopped;
+  #names = []; // events and plots names, in configuration order
+  #ws = null;
+  #subscribed = null; // names of the plots subscribed to
 
   /**
    * @param {string} uri           WebSocket URI
    * @param {Function} onConfig    callback(configData)
    * @param {Function} onData      callback(messageData)
+   * @param {Function} onEvent     callback(event, data), for other messages
+   * @param {Function} onStopped   callback(), when the server went away
    * @param {number} [initialTimeout=250]
    */
-  constructor(uri, onConfig, onData, initialTimeout = 250) {
+  constructor(uri, onConfig, onData, onEvent, onStopped, initialTimeout = 250) {
     this.#uri = uri;
     this.#timeout = initialTimeout;
     this.#onConfig = onConfig;
     this.#onData = onData;
+    this.#onEvent = onEvent;
+    this.#onStopped = onStopped;
     this.#connect();
   }
 
   #connect() {
-    const ws = new WebSocket(this.#uri);
+    const ws = new WebSocket(this.#uri, [packedProtocol]);
+    ws.binaryType = "arraybuffer";
+    this.#ws = ws;
     console.info(`WS connecting to ${this.#uri}`);
 
     ws.onopen = () => {
@@ -30,6 +72,11 @@ export default class WebSocketClient {
 
     ws.onclose = (ev) => {
       console.warn(`WS closed: ${ev.code}`);
+      if (ev.code === goingAway) {
+        // The server was shut down on purpose, don't try to reconnect.
+        this.#onStopped();
+        return;
+      }
       const delay = clamp((this.#timeout *= 2), 250, 5000);
       setTimeout(() => this.#connect(), delay);
     };
@@ -40,12 +87,48 @@ export default class WebSocketClient {
     };
 
     ws.onmessage = (ev) => {
+      // Even when the packed format is negotiated, the configuration, and the
+      // metrics of a replayed session, are sent as JSON text messages.
+      if (ev.data instanceof ArrayBuffer) {
+        this.#onData(unpack(ev.data, this.#names));
+        return;
+      }
+
       const msg = JSON.parse(ev.data);
       if (msg.event === "config") {
+        this.#names = [
+          ...msg.data.events,
+          ...msg.data.series.map((s) => s.name),
+        ];
+        this.#subscribed = null; // plots might have changed
         this.#onConfig(msg.data);
-      } else {
+      } else if (msg.event === "metrics") {
         this.#onData(msg.data);
+      } else {
+        this.#onEvent(msg.event, msg.data);
       }
     };
   }
+
+  // Connects again, after the server went away.
+  reconnect() {
+    this.#timeout = 250;
+    this.#connect();
+  }
+
+  // Sends a command to the server.
+  #command(event, data) {
+    if (this.#ws?.readyState !== WebSocket.OPEN) return false;
+    this.#ws.send(JSON.stringify({ event, data }));
+    return true;
+  }
+
+  // Subscribes to the given plots, so that the server only collects and
+  // sends those.
+  subscribe(names) {
+    const key = names.join(",");
+    if (this.#subscribed !== key && this.#command("subscribe", names)) {
+      this.#subscribed = key;
+    }
+  }
 }
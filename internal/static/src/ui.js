@@ -1,5 +1,6 @@
 import { plotMgr, drawPlots } from "./app.js";
 import { updateVisibility } from "./nav.js";
+import { downloadData } from "./download.js";
 import tippy from "tippy.js";
 
 export const onClickPlotMaximize = (cfg) => (_gd, _ev) => {
@@ -38,3 +39,28 @@ export const onClickPlotInfo = (gd, ev) => {
   }
   button.setAttribute("data-val", !val);
 };
+
+export const onClickPlotDownload = (cfg) => (_gd, ev) => {
+  const menu = document.createElement("div");
+  menu.className = "d-flex gap-1";
+
+  const instance = tippy(ev.currentTarget, {
+    content: menu,
+    interactive: true,
+    trigger: "manual",
+    appendTo: document.body,
+    onHidden: (t) => t.destroy(),
+  });
+  for (const format of ["csv", "json"]) {
+    const btn = document.createElement("button");
+    btn.type = "button";
+    btn.className = "btn btn-sm btn-outline-secondary";
+    btn.textContent = format.toUpperCase();
+    btn.addEventListener("click", () => {
+      downloadData(cfg.name, format);
+      instance.hide();
+    });
+    menu.append(btn);
+  }
+  instance.show();
+};
@@ -20,7 +20,7 @@ export const formatDuration = (sec) => {
     if (inc < 1) continue;
     return Math.round(inc) + durUnits[i];
   }
-  return res.trim();
+  return "0ns";
 };
 
 const bytesUnits = ["B", "KB", "MB", "GB", "TB", "PB", "EB"];
@@ -45,7 +45,13 @@ export const formatFunction = (unit) => {
       return formatBytes;
   }
   // Default formatting
-  return (y) => {
-    `${y} ${hover.yunit}`;
-  };
+  return (y) => `${y} ${unit}`.trim();
+};
+
+// Options of the bootstrap tooltips of the top bar.
+export const tooltipOptions = {
+  trigger: "hover focus",
+  delay: { show: 700, hide: 100 },
+  animation: true,
+  placement: "bottom",
 };
@@ -0,0 +1,68 @@
+package statsviz
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowedOrigins adds origins from which websocket connections are accepted,
+// in addition to the origin of the server itself. An origin is a scheme and a
+// host, with an optional port, for example "https://proxy.example.com:8443",
+// as sent by browsers in the Origin header. "*" allows all origins.
+//
+// This is necessary to serve Statsviz through a reverse proxy on a different
+// host. This option can be added multiple times.
+func AllowedOrigins(origins ...string) Option {
+	return func(s *Server) error {
+		for _, o := range origins {
+			s.allowedOrigins = append(s.allowedOrigins, strings.TrimSuffix(o, "/"))
+		}
+		return nil
+	}
+}
+
+// CheckOrigin sets a function called on each websocket connection request, to
+// decide whether the request Origin header is acceptable. It replaces the
+// default origin policy, and the one set with [AllowedOrigins]. By default,
+// only same-origin requests are accepted.
+func CheckOrigin(check func(r *http.Request) bool) Option {
+	return func(s *Server) error {
+		s.checkOrigin = check
+		return nil
+	}
+}
+
+// originAllowed reports whether the websocket connection request r has an
+// acceptable origin.
+func (s *Server) originAllowed(r *http.Request) bool {
+	if s.checkOrigin != nil {
+		return s.checkOrigin(r)
+	}
+
+	// Allow all origins for testing.
+	if debug {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	// Same origin.
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
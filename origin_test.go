@@ -0,0 +1,108 @@
+package statsviz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	if debug {
+		t.Skip("STATSVIZ_DEBUG allows all origins")
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		origin string
+		want   bool
+	}{
+		{name: "no origin", origin: "", want: true},
+		{name: "same origin", origin: "http://example.com", want: true},
+		{name: "same origin case", origin: "http://EXAMPLE.com", want: true},
+		{name: "other origin", origin: "http://proxy.com", want: false},
+		{name: "malformed origin", origin: "http://proxy.com:port", want: false},
+		{
+			name:   "allowed origin",
+			opts:   []Option{AllowedOrigins("https://proxy.com", "https://other.com/")},
+			origin: "https://other.com",
+			want:   true,
+		},
+		{
+			name:   "allowed origin scheme mismatch",
+			opts:   []Option{AllowedOrigins("https://proxy.com")},
+			origin: "http://proxy.com",
+			want:   false,
+		},
+		{
+			name:   "allowed origins multiple options",
+			opts:   []Option{AllowedOrigins("https://proxy.com"), AllowedOrigins("https://other.com")},
+			origin: "https://proxy.com",
+			want:   true,
+		},
+		{
+			name:   "allow all",
+			opts:   []Option{AllowedOrigins("*")},
+			origin: "https://anything.com",
+			want:   true,
+		},
+		{
+			name:   "custom check",
+			opts:   []Option{CheckOrigin(func(r *http.Request) bool { return r.Header.Get("Origin") == "null" })},
+			origin: "null",
+			want:   true,
+		},
+		{
+			name:   "custom check overrides allowed origins",
+			opts:   []Option{AllowedOrigins("*"), CheckOrigin(func(r *http.Request) bool { return false })},
+			origin: "http://example.com",
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t, tt.opts...)
+			defer srv.Close()
+
+			req := httptest.NewRequest("GET", "http://example.com/debug/statsviz/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := srv.originAllowed(req); got != tt.want {
+				t.Errorf("originAllowed() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginPerServer(t *testing.T) {
+	if debug {
+		t.Skip("STATSVIZ_DEBUG allows all origins")
+	}
+	t.Parallel()
+
+	dial := func(srv *Server, origin string) error {
+		s := httptest.NewServer(srv.Ws())
+		defer s.Close()
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[len("http"):], http.Header{"Origin": {origin}})
+		if err == nil {
+			ws.Close()
+		}
+		return err
+	}
+
+	srv1 := newServer(t, AllowedOrigins("https://proxy1.com"))
+	defer srv1.Close()
+	srv2 := newServer(t)
+	defer srv2.Close()
+
+	if err := dial(srv1, "https://proxy1.com"); err != nil {
+		t.Errorf("server 1 rejected allowed origin: %v", err)
+	}
+	if err := dial(srv2, "https://proxy1.com"); err == nil {
+		t.Errorf("server 2 accepted origin only allowed by server 1")
+	}
+}
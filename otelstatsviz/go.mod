@@ -0,0 +1,27 @@
+module github.com/arl/statsviz/otelstatsviz
+
+go 1.23.0
+
+toolchain go1.24.5
+
+require (
+	github.com/arl/statsviz v0.9.0
+	go.opentelemetry.io/otel v1.36.0
+	go.opentelemetry.io/otel/sdk v1.36.0
+	go.opentelemetry.io/otel/sdk/metric v1.36.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/metric v1.36.0 // indirect
+	go.opentelemetry.io/otel/trace v1.36.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+)
+
+// Changes to statsviz are developed alongside, the replace directive only
+// applies within this repository.
+replace github.com/arl/statsviz => ../
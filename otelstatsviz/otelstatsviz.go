@@ -0,0 +1,213 @@
+// Package otelstatsviz exports the plots of a statsviz Server as OpenTelemetry
+// metrics.
+//
+// Values are those computed by Statsviz for its user interface, user plots
+// included, so that a single plot definition drives both. Each time series
+// plot is a gauge, with one data point per time series, identified by the
+// 'series' attribute. Heatmaps whose bucket counts are cumulative, like
+// 'runnable-time' or 'stopping-pauses-gc', are histograms. Other heatmaps,
+// which show the current state of a distribution, like 'size-classes' and user
+// heatmaps, are gauges with one data point per bucket, identified by the 'le'
+// attribute holding the bucket upper bound.
+//
+// Since the OpenTelemetry metrics API has no asynchronous histogram, plots are
+// exported by a [Producer], to be registered with the readers of a meter
+// provider:
+//
+//	srv, _ := statsviz.NewServer()
+//	producer, _ := otelstatsviz.NewProducer(srv)
+//	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithProducer(producer))
+//	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+package otelstatsviz
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/arl/statsviz"
+)
+
+// ScopeName is the instrumentation scope of the exported metrics.
+const ScopeName = "github.com/arl/statsviz/otelstatsviz"
+
+// start approximates the start time of the process, since which runtime
+// metrics are cumulated.
+var start = time.Now()
+
+// A Producer produces the metrics of the plots of a statsviz Server. It
+// implements the Producer interface of go.opentelemetry.io/otel/sdk/metric.
+type Producer struct {
+	srv   *statsviz.Server
+	plots map[string]statsviz.PlotInfo
+}
+
+// NewProducer returns a Producer of the metrics of the plots of srv. Values
+// are those of the last collection: the server then collects metrics
+// continuously, even if no user interface is connected.
+//
+// NewProducer fails if srv doesn't collect the metrics of the current program,
+// as when replaying a recorded session or aggregating remote programs.
+func NewProducer(srv *statsviz.Server) (*Producer, error) {
+	infos := srv.Plots()
+	if infos == nil {
+		return nil, errors.New("otelstatsviz: server doesn't collect the metrics of the current program")
+	}
+	p := &Producer{srv: srv, plots: make(map[string]statsviz.PlotInfo)}
+	for _, info := range infos {
+		p.plots[info.Name] = info
+	}
+	// Start the continuous collection, for the first call to Produce.
+	srv.Snapshot()
+	return p, nil
+}
+
+// Produce returns the metrics of all plots, as of their last collection.
+// Nothing is returned before the first collection.
+func (p *Producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	snap := p.srv.Snapshot()
+	if snap.Time.IsZero() {
+		return nil, nil
+	}
+
+	sm := metricdata.ScopeMetrics{Scope: instrumentation.Scope{Name: ScopeName}}
+	for _, ps := range snap.Plots {
+		info, ok := p.plots[ps.Name]
+		switch {
+		case !ok:
+			continue
+		case !info.Heatmap:
+			sm.Metrics = append(sm.Metrics, gauge(info, ps, snap.Time))
+		case info.Cumulative:
+			sm.Metrics = append(sm.Metrics, histogram(info, ps, snap.Time))
+		default:
+			sm.Metrics = append(sm.Metrics, bucketGauge(info, ps, snap.Time))
+		}
+	}
+	return []metricdata.ScopeMetrics{sm}, nil
+}
+
+func gauge(info statsviz.PlotInfo, ps statsviz.PlotSnapshot, now time.Time) metricdata.Metrics {
+	var data metricdata.Gauge[float64]
+	for i, name := range ps.Subplots {
+		if i >= len(ps.Values) {
+			break
+		}
+		data.DataPoints = append(data.DataPoints, metricdata.DataPoint[float64]{
+			Attributes: attribute.NewSet(attribute.String("series", name)),
+			Time:       now,
+			Value:      ps.Values[i],
+		})
+	}
+	return metricdata.Metrics{
+		Name:        metricName(info.Name),
+		Description: info.Title,
+		Unit:        scatterUnit(info.Unitfmts),
+		Data:        data,
+	}
+}
+
+// histogram returns the histogram of a cumulative heatmap. The runtime doesn't
+// record the sum of the observations, it is estimated by considering that
+// they're all equal to the upper bound of their bucket, as shown on the user
+// interface.
+func histogram(info statsviz.PlotInfo, ps statsviz.PlotSnapshot, now time.Time) metricdata.Metrics {
+	dp := metricdata.HistogramDataPoint[float64]{
+		StartTime:    start,
+		Time:         now,
+		BucketCounts: make([]uint64, len(ps.Values)),
+	}
+	for i, v := range ps.Values {
+		dp.BucketCounts[i] = uint64(v)
+		dp.Count += uint64(v)
+		if i < len(ps.Buckets) {
+			dp.Sum += v * ps.Buckets[i]
+		}
+		// The last bucket upper bound is +Inf, but the snapshot holds the
+		// value used to draw it.
+		if i < len(ps.Values)-1 && i < len(ps.Buckets) {
+			dp.Bounds = append(dp.Bounds, ps.Buckets[i])
+		}
+	}
+	return metricdata.Metrics{
+		Name:        metricName(info.Name),
+		Description: info.Title,
+		Unit:        heatmapUnit(info.Unit),
+		Data: metricdata.Histogram[float64]{
+			DataPoints:  []metricdata.HistogramDataPoint[float64]{dp},
+			Temporality: metricdata.CumulativeTemporality,
+		},
+	}
+}
+
+// bucketGauge returns a gauge of the bucket counts of a heatmap, with one data
+// point per bucket.
+func bucketGauge(info statsviz.PlotInfo, ps statsviz.PlotSnapshot, now time.Time) metricdata.Metrics {
+	var data metricdata.Gauge[float64]
+	for i, v := range ps.Values {
+		le := "+Inf"
+		if i < len(ps.Values)-1 && i < len(ps.Buckets) {
+			le = strconv.FormatFloat(ps.Buckets[i], 'g', -1, 64)
+		}
+		data.DataPoints = append(data.DataPoints, metricdata.DataPoint[float64]{
+			Attributes: attribute.NewSet(attribute.String("le", le)),
+			Time:       now,
+			Value:      v,
+		})
+	}
+	return metricdata.Metrics{
+		Name:        metricName(info.Name),
+		Description: info.Title,
+		Data:        data,
+	}
+}
+
+// metricName converts a plot name into a valid instrument name.
+func metricName(plot string) string {
+	var sb strings.Builder
+	sb.WriteString("statsviz.")
+	for _, r := range plot {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-', r == '/':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// scatterUnit returns the unit of the time series of a plot, from the suffix of
+// their d3-format strings, or the empty string if they don't all have the same
+// unit.
+func scatterUnit(unitfmts []string) string {
+	var unit string
+	for i, unitfmt := range unitfmts {
+		u := unitfmt[strings.LastIndexByte(unitfmt, '}')+1:]
+		if u == "B" {
+			u = "By"
+		}
+		if i > 0 && u != unit {
+			return ""
+		}
+		unit = u
+	}
+	return unit
+}
+
+// heatmapUnit returns the unit of the bucket boundaries of a heatmap.
+func heatmapUnit(unit statsviz.HeatmapUnit) string {
+	switch unit {
+	case statsviz.HeatmapUnitDuration:
+		return "s"
+	case statsviz.HeatmapUnitBytes:
+		return "By"
+	}
+	return string(unit)
+}
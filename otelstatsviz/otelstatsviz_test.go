@@ -0,0 +1,165 @@
+package otelstatsviz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/arl/statsviz"
+)
+
+var _ sdkmetric.Producer = (*Producer)(nil)
+
+func TestProducer(t *testing.T) {
+	t.Parallel()
+
+	tsp, err := statsviz.TimeSeriesPlotConfig{
+		Name:  "cache",
+		Title: "Cache",
+		Series: []statsviz.TimeSeries{
+			{Name: "used", Unitfmt: "%{y:.4s}B", GetValue: func() float64 { return 42 }},
+			{Name: "free", Unitfmt: "%{y:.4s}B", GetValue: func() float64 { return 58 }},
+		},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hp, err := statsviz.HeatmapPlotConfig{
+		Name:     "latency",
+		Buckets:  []float64{0, 1, 2},
+		Unit:     statsviz.HeatmapUnitDuration,
+		GetValue: func() []uint64 { return []uint64{3, 4} },
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := statsviz.NewServer(
+		statsviz.SendFrequency(10*time.Millisecond),
+		statsviz.TimeseriesPlot(tsp),
+		statsviz.HeatmapPlot(hp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	producer, err := NewProducer(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(producer))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	// Metrics are collected for the producer, though no client is connected.
+	metrics := make(map[string]metricdata.Metrics)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(metrics) == 0 {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		for _, sm := range rm.ScopeMetrics {
+			if sm.Scope.Name != ScopeName {
+				continue
+			}
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no metrics produced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cache := metrics["statsviz.cache"]
+	if cache.Unit != "By" || cache.Description != "Cache" {
+		t.Errorf("cache unit = %q, description = %q, want By, Cache", cache.Unit, cache.Description)
+	}
+	gauge, ok := cache.Data.(metricdata.Gauge[float64])
+	if !ok || len(gauge.DataPoints) != 2 {
+		t.Fatalf("cache data = %#v, want a gauge with 2 data points", cache.Data)
+	}
+	for i, want := range []struct {
+		series string
+		value  float64
+	}{{"used", 42}, {"free", 58}} {
+		dp := gauge.DataPoints[i]
+		if series, _ := dp.Attributes.Value("series"); series.AsString() != want.series || dp.Value != want.value {
+			t.Errorf("cache data point %d = %s %v, want %s %v", i, series.AsString(), dp.Value, want.series, want.value)
+		}
+	}
+
+	rt := metrics["statsviz.runnable-time"]
+	if rt.Unit != "s" {
+		t.Errorf("runnable-time unit = %q, want s", rt.Unit)
+	}
+	hist, ok := rt.Data.(metricdata.Histogram[float64])
+	if !ok || len(hist.DataPoints) != 1 {
+		t.Fatalf("runnable-time data = %#v, want an histogram with 1 data point", rt.Data)
+	}
+	if hist.Temporality != metricdata.CumulativeTemporality {
+		t.Errorf("runnable-time temporality = %v, want cumulative", hist.Temporality)
+	}
+	if dp := hist.DataPoints[0]; len(dp.BucketCounts) != len(dp.Bounds)+1 {
+		t.Errorf("runnable-time has %d buckets and %d bounds", len(dp.BucketCounts), len(dp.Bounds))
+	}
+
+	// User heatmaps aren't cumulative, each bucket is a gauge data point.
+	gauge, ok = metrics["statsviz.latency"].Data.(metricdata.Gauge[float64])
+	if !ok || len(gauge.DataPoints) != 2 {
+		t.Fatalf("latency data = %#v, want a gauge with 2 data points", metrics["statsviz.latency"].Data)
+	}
+	for i, want := range []struct {
+		le    string
+		value float64
+	}{{"1", 3}, {"+Inf", 4}} {
+		dp := gauge.DataPoints[i]
+		if le, _ := dp.Attributes.Value("le"); le.AsString() != want.le || dp.Value != want.value {
+			t.Errorf("latency data point %d = %s %v, want %s %v", i, le.AsString(), dp.Value, want.le, want.value)
+		}
+	}
+
+	if _, ok := metrics["statsviz.size-classes"].Data.(metricdata.Gauge[float64]); !ok {
+		t.Errorf("size-classes data = %#v, want a gauge", metrics["statsviz.size-classes"].Data)
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		plot, want string
+	}{
+		{"runnable-time", "statsviz.runnable-time"},
+		{"gc/pauses", "statsviz.gc/pauses"},
+		{"my plot!", "statsviz.my_plot_"},
+	}
+	for _, tt := range tests {
+		if got := metricName(tt.plot); got != tt.want {
+			t.Errorf("metricName(%q) = %q, want %q", tt.plot, got, tt.want)
+		}
+	}
+}
+
+func TestScatterUnit(t *testing.T) {
+	tests := []struct {
+		unitfmts []string
+		want     string
+	}{
+		{[]string{"%{y:.4s}B", "%{y:.4s}B"}, "By"},
+		{[]string{"%{y:.4s}s"}, "s"},
+		{[]string{"%{y}"}, ""},
+		{[]string{""}, ""},
+		{[]string{"%{y:.2f}%"}, "%"},
+		{[]string{"%{y:.4s}B", "%{y:.4s}s"}, ""},
+	}
+	for _, tt := range tests {
+		if got := scatterUnit(tt.unitfmts); got != tt.want {
+			t.Errorf("scatterUnit(%q) = %q, want %q", tt.unitfmts, got, tt.want)
+		}
+	}
+}
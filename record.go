@@ -0,0 +1,79 @@
+package statsviz
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// recorder writes the plots configuration and all metrics messages into a
+// file, as newline-delimited JSON, optionally gzip-compressed.
+type recorder struct {
+	mu     sync.Mutex
+	f      *os.File
+	gz     *gzip.Writer // nil if not compressed
+	w      *bufio.Writer
+	closed bool
+}
+
+// newRecorder creates the named file. If name ends with .gz, the recording is
+// gzip-compressed.
+func newRecorder(name string) (*recorder, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recorder{f: f}
+	var w io.Writer = f
+	if strings.HasSuffix(name, ".gz") {
+		rec.gz = gzip.NewWriter(f)
+		w = rec.gz
+	}
+	rec.w = bufio.NewWriter(w)
+	return rec, nil
+}
+
+// writeConfig writes the plots configuration message.
+func (rec *recorder) writeConfig(cfg any) error {
+	buf, err := json.Marshal(wsmsg{Event: "config", Data: cfg})
+	if err != nil {
+		return err
+	}
+	return rec.write(append(buf, '\n'))
+}
+
+// write writes a message, which must be terminated by a newline.
+func (rec *recorder) write(msg []byte) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.closed {
+		return os.ErrClosed
+	}
+	_, err := rec.w.Write(msg)
+	return err
+}
+
+// close flushes the recording and closes the file.
+func (rec *recorder) close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.closed {
+		return nil
+	}
+	rec.closed = true
+
+	errs := []error{rec.w.Flush()}
+	if rec.gz != nil {
+		errs = append(errs, rec.gz.Close())
+	}
+	errs = append(errs, rec.f.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package statsviz
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readRecording(t *testing.T, name string) []wsmsg {
+	t.Helper()
+
+	rc, err := openRecording(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var msgs []wsmsg
+	scan := bufio.NewScanner(rc)
+	scan.Buffer(nil, 1<<20)
+	for scan.Scan() {
+		var msg wsmsg
+		if err := json.Unmarshal(scan.Bytes(), &msg); err != nil {
+			t.Fatalf("malformed recorded message: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestRecord(t *testing.T) {
+	for _, name := range []string{"session.ndjson", "session.ndjson.gz"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			name := filepath.Join(t.TempDir(), name)
+			srv := newServer(t, Record(name), SendFrequency(10*time.Millisecond))
+			time.Sleep(100 * time.Millisecond)
+			if err := srv.Close(); err != nil {
+				t.Fatalf("Close() = %v", err)
+			}
+
+			// Check compression.
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = gzip.NewReader(f)
+			f.Close()
+			if compressed := err == nil; compressed != (filepath.Ext(name) == ".gz") {
+				t.Errorf("recording compressed = %t, want %t", compressed, !compressed)
+			}
+
+			msgs := readRecording(t, name)
+			if len(msgs) < 2 {
+				t.Fatalf("got %d recorded messages, want at least 2", len(msgs))
+			}
+			if msgs[0].Event != "config" {
+				t.Errorf("first recorded message is %q, want config", msgs[0].Event)
+			}
+			for i, msg := range msgs[1:] {
+				if msg.Event != "metrics" {
+					t.Errorf("recorded message %d is %q, want metrics", i+1, msg.Event)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	notrec := filepath.Join(dir, "notrec")
+	if err := os.WriteFile(notrec, []byte(`{"foo": "bar"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	badgz := filepath.Join(dir, "bad.gz")
+	if err := os.WriteFile(badgz, []byte{0x1f, 0x8b, 0, 0}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]Option{
+		"not found":        {Replay(filepath.Join(dir, "notfound"), 1)},
+		"not a recording":  {Replay(notrec, 1)},
+		"empty":            {Replay(empty, 1)},
+		"malformed gzip":   {Replay(badgz, 1)},
+		"zero speed":       {Replay(notrec, 0)},
+		"record on replay": {Replay(notrec, 1), Record(filepath.Join(dir, "rec"))},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewServer(opts...); err == nil {
+				t.Errorf("NewServer() should have errored")
+			}
+		})
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "session.ndjson.gz")
+	rec := newServer(t, Record(name), SendFrequency(10*time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer(t, Replay(name, 10))
+	defer srv.Close()
+
+	testWs(t, srv.Ws(), "http://example.com/debug/statsviz/ws")
+
+	// Metrics are not available.
+	req := httptest.NewRequest("GET", "http://example.com/metrics", nil)
+	w := httptest.NewRecorder()
+	srv.Metrics()(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("metrics handler responded %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
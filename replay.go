@@ -0,0 +1,190 @@
+package statsviz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// replayer streams a session recorded with the [Record] option to websocket
+// clients. Each client gets its own replay, starting from the beginning of the
+// recording.
+type replayer struct {
+	ctx     context.Context
+	running *tracker // replays, waited for on shutdown
+	name    string
+	speed   float64
+}
+
+// openRecording opens a recording, transparently decompressing it if it's
+// gzip-compressed.
+func openRecording(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, f}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// check verifies that the recording can be opened and starts with a config
+// message.
+func (rp *replayer) check() error {
+	rc, err := openRecording(rp.name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	line, err := bufio.NewReader(rc).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %v", rp.name, err)
+	}
+
+	var msg wsmsg
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Event != "config" {
+		return fmt.Errorf("%s: not a statsviz recording", rp.name)
+	}
+	return nil
+}
+
+// serve starts replaying the recording to the client, unless the server is
+// shutting down.
+func (rp *replayer) serve(conn *websocket.Conn) {
+	if !rp.running.start() {
+		if rp.running.closing() {
+			_ = goingAway(conn)
+		}
+		conn.Close()
+		return
+	}
+	go func() {
+		rp.running.done(rp.stream(conn))
+	}()
+}
+
+// stream sends the recording to the client, at the recorded pace multiplied by
+// the replay speed. It then waits for the client to go away. If the server
+// shuts down in the meantime, stream returns the error that occurred while
+// telling the client.
+func (rp *replayer) stream(conn *websocket.Conn) error {
+	defer conn.Close()
+
+	rc, err := openRecording(rp.name)
+	if err != nil {
+		dbglog("failed to open recording: %v", err)
+		return nil
+	}
+	defer rc.Close()
+
+	var (
+		br    = bufio.NewReader(rc)
+		start time.Time // when the first metrics message was sent
+		first int64     // timestamp of the first metrics message
+	)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if !errors.Is(err, io.EOF) {
+				dbglog("failed to read recording: %v", err)
+			}
+			break
+		}
+
+		var msg struct {
+			Data struct {
+				Timestamp int64 `json:"timestamp"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			dbglog("skipping malformed recorded message: %v", err)
+			continue
+		}
+
+		if ts := msg.Data.Timestamp; ts != 0 {
+			if start.IsZero() {
+				start, first = time.Now(), ts
+			}
+			elapsed := time.Duration(float64(ts-first) * float64(time.Millisecond) / rp.speed)
+			timer.Reset(time.Until(start.Add(elapsed)))
+			select {
+			case <-rp.ctx.Done():
+				if !rp.running.closing() {
+					return nil
+				}
+				return goingAway(conn)
+			case <-timer.C:
+			}
+		}
+
+		if err := sendbuf(conn, websocket.TextMessage, line); err != nil {
+			dbglog("failed to send recorded data: %v", err)
+			return nil
+		}
+	}
+
+	// Keep the connection open, so that the user interface keeps showing the
+	// replayed data, until the client goes away. On shutdown, the client gets
+	// some time to acknowledge the close frame.
+	done := make(chan struct{})
+	defer close(done)
+	closed := make(chan error, 1)
+	go func() {
+		select {
+		case <-rp.ctx.Done():
+			if !rp.running.closing() {
+				conn.Close()
+				return
+			}
+			err := goingAway(conn)
+			closed <- err
+			if err != nil {
+				conn.Close()
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		case <-done:
+		}
+	}()
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			break
+		}
+	}
+	select {
+	case err := <-closed:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package statsviz
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout is how long the server waits for a client to acknowledge a
+// close frame, before closing the connection anyway.
+const closeTimeout = time.Second
+
+// Shutdown gracefully shuts down the Server. It stops collecting metrics,
+// sends a close frame telling each websocket client that the server is going
+// away, and waits for the connections to be closed, or for ctx to expire. The
+// recording, if any, is then flushed and closed.
+//
+// Shutdown returns the errors that occurred while closing the connections and
+// the recording, and the context error if ctx expired first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.running.stop(true)
+	s.cancel()
+	err := s.running.wait(ctx)
+	if s.rec != nil {
+		err = errors.Join(err, s.rec.close())
+	}
+	return err
+}
+
+// tracker tracks the goroutines of the server, so that Shutdown can wait for
+// them to finish.
+type tracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	stopping bool
+	graceful bool    // connections are closed with a close frame
+	errs     []error // errors that occurred while closing connections
+}
+
+// start registers a new goroutine. It returns false if the server is shutting
+// down, in which case the goroutine must not be started.
+func (t *tracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopping {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+// done marks a goroutine as finished. err is the error that occurred while
+// closing its connection, if any.
+func (t *tracker) done(err error) {
+	if err != nil {
+		t.mu.Lock()
+		t.errs = append(t.errs, err)
+		t.mu.Unlock()
+	}
+	t.wg.Done()
+}
+
+// stop prevents new goroutines from starting. If graceful is true, the
+// running goroutines close their connection with a close frame.
+func (t *tracker) stop(graceful bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopping = true
+	t.graceful = graceful
+}
+
+// closing reports whether the connections have to be closed with a close
+// frame.
+func (t *tracker) closing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.graceful
+}
+
+// wait waits for the running goroutines to finish, or for ctx to expire.
+func (t *tracker) wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-finished:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return errors.Join(t.errs...)
+}
+
+// goingAway sends a close frame telling the client that the server is going
+// away. Closing a connection which the client already closed isn't an error.
+func goingAway(conn *websocket.Conn) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server going away")
+	err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+	if errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package statsviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// A Sink receives the values of the plots, as computed by Statsviz, each time
+// they're collected, in order to ship them to some other backend.
+//
+// Write is called from the collection goroutine, so it shouldn't block for
+// long. Sinks must not modify the snapshots they receive, but can keep them.
+// Close is called once the server stops collecting metrics.
+type Sink interface {
+	Write(Snapshot) error
+	Close() error
+}
+
+// AddSink adds a sink receiving the values of the plots each time they're
+// collected. Metrics are then collected continuously, even if no client is
+// connected. This option can be added multiple times.
+func AddSink(sink Sink) Option {
+	return func(s *Server) error {
+		if sink == nil {
+			return errors.New("nil sink")
+		}
+		s.sinks = append(s.sinks, sink)
+		return nil
+	}
+}
+
+// writeSinks writes a snapshot to all sinks.
+func writeSinks(sinks []Sink, snap Snapshot) {
+	for _, sink := range sinks {
+		if err := sink.Write(snap); err != nil {
+			dbglog("failed to write to sink: %v", err)
+		}
+	}
+}
+
+// closeSinks closes all sinks.
+func closeSinks(sinks []Sink) error {
+	var errs []error
+	for _, sink := range sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// jsonLinesSink writes snapshots as JSON lines.
+type jsonLinesSink struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink returns a sink writing each snapshot to w as a line of
+// JSON, as marshaled by [Snapshot]. Closing the sink doesn't close w.
+func NewJSONLinesSink(w io.Writer) Sink {
+	return &jsonLinesSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonLinesSink) Write(snap Snapshot) error {
+	return s.enc.Encode(snap)
+}
+
+func (s *jsonLinesSink) Close() error { return nil }
+
+// maxStatsDPacket is the maximum size of the packets sent by the StatsD sink,
+// so that they fit in a single ethernet frame.
+const maxStatsDPacket = 1432
+
+// statsdSink sends snapshots to a StatsD server.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+	buf    bytes.Buffer
+}
+
+// NewStatsDSink returns a sink sending the values of the plots to the StatsD
+// server listening at the given UDP address, as gauges. The value of each
+// time series is sent as a gauge named <prefix>.<plot>.<time series>, and the
+// count of each bucket of a heatmap is sent as a gauge named
+// <prefix>.<plot>.le_<upper bound>. Names are sanitized, so that they only
+// contain letters, digits, underscores and hyphens.
+func NewStatsDSink(addr, prefix string) (Sink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *statsdSink) Write(snap Snapshot) error {
+	var errs []error
+	send := func() {
+		if s.buf.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+			errs = append(errs, err)
+		}
+		s.buf.Reset()
+	}
+	gauge := func(name string, val float64) {
+		line := name + ":" + strconv.FormatFloat(val, 'g', -1, 64) + "|g\n"
+		if s.buf.Len()+len(line) > maxStatsDPacket {
+			send()
+		}
+		s.buf.WriteString(line)
+	}
+
+	for _, p := range snap.Plots {
+		name := statsdName(p.Name)
+		if s.prefix != "" {
+			name = statsdName(s.prefix) + "." + name
+		}
+		for i, v := range p.Values {
+			switch {
+			case i < len(p.Subplots):
+				gauge(name+"."+statsdName(p.Subplots[i]), v)
+			case i < len(p.Buckets):
+				gauge(name+".le_"+statsdName(strconv.FormatFloat(p.Buckets[i], 'g', -1, 64)), v)
+			}
+		}
+	}
+	send()
+	return errors.Join(errs...)
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+// statsdName converts a plot or time series name into a valid StatsD name
+// component.
+func statsdName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,152 @@
+package statsviz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink is a sink keeping the snapshots it receives.
+type fakeSink struct {
+	mu     sync.Mutex
+	snaps  []Snapshot
+	closed bool
+}
+
+func (s *fakeSink) Write(snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snaps = append(s.snaps, snap)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+// snapshots returns the snapshots received so far, and whether the sink is
+// closed.
+func (s *fakeSink) snapshots() ([]Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.snaps), s.closed
+}
+
+func TestSink(t *testing.T) {
+	t.Parallel()
+
+	sink := &fakeSink{}
+	srv := newServer(t, SendFrequency(10*time.Millisecond), AddSink(sink))
+
+	// Metrics are collected for the sink, though no client is connected.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if snaps, _ := sink.snapshots(); len(snaps) >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sink didn't receive snapshots")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	snaps, closed := sink.snapshots()
+	if !closed {
+		t.Errorf("sink not closed by Shutdown")
+	}
+
+	plots := make(map[string]PlotSnapshot)
+	for _, p := range snaps[0].Plots {
+		plots[p.Name] = p
+	}
+	if cgo := plots["cgo"]; len(cgo.Subplots) != 1 || len(cgo.Values) != 1 || cgo.Buckets != nil {
+		t.Errorf("cgo plot = %+v, want 1 time series", cgo)
+	}
+	if sc := plots["size-classes"]; len(sc.Values) < 2 || len(sc.Buckets) != len(sc.Values) || sc.Subplots != nil {
+		t.Errorf("size-classes plot = %+v, want a value per bucket", sc)
+	}
+	if !snaps[1].Time.After(snaps[0].Time) {
+		t.Errorf("snapshot times %v and %v aren't increasing", snaps[0].Time, snaps[1].Time)
+	}
+}
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Time: time.UnixMilli(1700000000000),
+		Plots: []PlotSnapshot{
+			{Name: "http requests", Subplots: []string{"2xx", "5xx"}, Values: []float64{10, 0.5}},
+			{Name: "latency", Values: []float64{3, 1}, Buckets: []float64{0.5, 1}},
+		},
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	for range 2 {
+		if err := sink.Write(testSnapshot()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	want := `{"time":1700000000000,"plots":[` +
+		`{"name":"http requests","subplots":["2xx","5xx"],"values":[10,0.5]},` +
+		`{"name":"latency","values":[3,1],"buckets":[0.5,1]}]}`
+	if lines[0] != want {
+		t.Errorf("got line\n%s\nwant\n%s", lines[0], want)
+	}
+	if !json.Valid([]byte(lines[1])) {
+		t.Errorf("invalid JSON line %s", lines[1])
+	}
+}
+
+func TestStatsDSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxStatsDPacket)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "app.http_requests.2xx:10|g\n" +
+		"app.http_requests.5xx:0.5|g\n" +
+		"app.latency.le_0_5:3|g\n" +
+		"app.latency.le_1:1|g\n"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("got packet\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package statsviz
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+// Snapshot holds the values of the plots collected at the same instant. Since
+// plots can have their own collection interval, a snapshot only holds the
+// plots that were due.
+//
+// A Snapshot is marshaled to JSON as:
+//
+//	{"time":1700000000000,"plots":[{"name":"cgo","subplots":["calls from go to c"],"values":[0]}, ...]}
+//
+// where time is in milliseconds since the Unix epoch, or 0 for the zero time.
+type Snapshot struct {
+	Time  time.Time
+	Plots []PlotSnapshot
+}
+
+// PlotSnapshot holds the values of a plot: for a time series plot, the name
+// and value of each time series and, for a heatmap, the upper bound and count
+// of each bucket.
+type PlotSnapshot struct {
+	// Name is the plot name.
+	Name string `json:"name"`
+
+	// Subplots contains the names of the time series of a time series plot,
+	// nil for a heatmap.
+	Subplots []string `json:"subplots,omitempty"`
+
+	// Values contains, for a time series plot, the value of each time series
+	// and, for a heatmap, the count of each bucket.
+	Values []float64 `json:"values"`
+
+	// Buckets contains the upper bound of each bucket of a heatmap, nil for a
+	// time series plot. If the last bucket is unbounded, its upper bound is
+	// extrapolated from the previous ones, as shown on the user interface.
+	Buckets []float64 `json:"buckets,omitempty"`
+}
+
+// PlotInfo describes a plot of the snapshots.
+type PlotInfo struct {
+	// Name is the plot name.
+	Name string
+
+	// Title is the plot title, as shown on the user interface.
+	Title string
+
+	// Heatmap reports whether the plot is a heatmap, rather than a time
+	// series plot.
+	Heatmap bool
+
+	// Unitfmts contains the d3-format strings of the values of the time
+	// series of a time series plot, nil for a heatmap.
+	Unitfmts []string
+
+	// Unit is the unit of the bucket boundaries of a heatmap, empty for a
+	// time series plot.
+	Unit HeatmapUnit
+
+	// Cumulative reports whether the bucket counts of a heatmap only ever
+	// increase, like those of 'runnable-time', as opposed to representing the
+	// current state of a distribution, like those of 'size-classes'.
+	Cumulative bool
+}
+
+type jsonSnapshot struct {
+	Time  int64          `json:"time"`
+	Plots []PlotSnapshot `json:"plots"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	js := jsonSnapshot{Plots: s.Plots}
+	if !s.Time.IsZero() {
+		js.Time = s.Time.UnixMilli()
+	}
+	if js.Plots == nil {
+		js.Plots = []PlotSnapshot{}
+	}
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Snapshot) UnmarshalJSON(b []byte) error {
+	var js jsonSnapshot
+	if err := json.Unmarshal(b, &js); err != nil {
+		return err
+	}
+	s.Time = time.Time{}
+	if js.Time != 0 {
+		s.Time = time.UnixMilli(js.Time)
+	}
+	s.Plots = js.Plots
+	return nil
+}
+
+// snapshot returns the snapshot of the plots of the frame, in the order of the
+// configuration. Values are shared with the frame.
+func (f *frame) snapshot() Snapshot {
+	snap := Snapshot{Time: f.Time}
+	for _, layout := range f.cfg.Series {
+		vals, ok := f.Series[plot.LayoutName(layout)]
+		if !ok {
+			continue
+		}
+
+		ps := PlotSnapshot{Values: vals}
+		switch layout := layout.(type) {
+		case plot.Scatter:
+			ps.Name = layout.Name
+			ps.Subplots = make([]string, len(layout.Subplots))
+			for i, sp := range layout.Subplots {
+				ps.Subplots[i] = sp.Name
+			}
+		case plot.Heatmap:
+			ps.Name = layout.Name
+			ps.Buckets = layout.CustomData
+		}
+		snap.Plots = append(snap.Plots, ps)
+	}
+	return snap
+}
+
+// Snapshot returns the values of all plots, user plots included, as of their
+// last collection, which are those currently shown on the user interface. The
+// snapshot time is that of the last collection.
+//
+// Calling Snapshot keeps metrics collection running, even if no user interface
+// is connected. The snapshot is empty before the first collection, and when
+// the server doesn't collect the metrics of the current program, as when
+// replaying a recorded session or aggregating remote programs.
+func (s *Server) Snapshot() Snapshot {
+	s.keepCollecting()
+	if s.plots == nil {
+		return Snapshot{}
+	}
+	t, last := s.plots.Last()
+	if t.IsZero() {
+		return Snapshot{}
+	}
+	// Values are copied since they're shared with the other readers of the
+	// last values.
+	snap := newFrame(&plot.Frame{Time: t, Series: last}, s.plots.Config()).snapshot()
+	for i := range snap.Plots {
+		snap.Plots[i].Values = slices.Clone(snap.Plots[i].Values)
+		snap.Plots[i].Buckets = slices.Clone(snap.Plots[i].Buckets)
+	}
+	return snap
+}
+
+// Plots describes the plots of the snapshots returned by [Server.Snapshot], in
+// the same order. Plots returns nil when the server doesn't collect the
+// metrics of the current program.
+func (s *Server) Plots() []PlotInfo {
+	if s.plots == nil {
+		return nil
+	}
+	var infos []PlotInfo
+	for _, layout := range s.plots.Config().Series {
+		switch layout := layout.(type) {
+		case plot.Scatter:
+			info := PlotInfo{Name: layout.Name, Title: layout.Title}
+			for _, sp := range layout.Subplots {
+				info.Unitfmts = append(info.Unitfmts, sp.Unitfmt)
+			}
+			infos = append(infos, info)
+		case plot.Heatmap:
+			infos = append(infos, PlotInfo{
+				Name:       layout.Name,
+				Title:      layout.Title,
+				Heatmap:    true,
+				Unit:       HeatmapUnit(layout.Hover.YUnit),
+				Cumulative: layout.Cumulative(),
+			})
+		}
+	}
+	return infos
+}
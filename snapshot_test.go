@@ -0,0 +1,175 @@
+package statsviz
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arl/statsviz/internal/plot"
+)
+
+func TestServerSnapshot(t *testing.T) {
+	t.Parallel()
+
+	tsp, err := TimeSeriesPlotConfig{
+		Name:   "queue",
+		Series: []TimeSeries{{Name: "length", GetValue: func() float64 { return 7 }}},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(t, SendFrequency(10*time.Millisecond), TimeseriesPlot(tsp))
+	defer srv.Close()
+
+	// Metrics are collected for Snapshot, though no client is connected.
+	var snap Snapshot
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if snap = srv.Snapshot(); len(snap.Plots) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("empty snapshot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var queue *PlotSnapshot
+	for i := range snap.Plots {
+		if snap.Plots[i].Name == "queue" {
+			queue = &snap.Plots[i]
+		}
+	}
+	if queue == nil || len(queue.Values) != 1 || queue.Values[0] != 7 || queue.Subplots[0] != "length" {
+		t.Fatalf("queue plot = %+v, want length 7", queue)
+	}
+
+	// Snapshots can't alter the last values.
+	queue.Values[0] = 0
+	for _, p := range srv.Snapshot().Plots {
+		if p.Name == "queue" && p.Values[0] != 7 {
+			t.Errorf("modifying a snapshot changed the last values")
+		}
+	}
+
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Snapshot
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Time.UnixMilli() != snap.Time.UnixMilli() || len(got.Plots) != len(snap.Plots) {
+		t.Errorf("unmarshaled snapshot = %+v, want %+v", got, snap)
+	}
+}
+
+func TestServerSnapshotEmpty(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t)
+	defer srv.Close()
+
+	if snap := srv.Snapshot(); !snap.Time.IsZero() || len(snap.Plots) != 0 {
+		t.Errorf("Snapshot() = %+v before first collection, want empty", snap)
+	}
+	buf, err := json.Marshal(srv.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"time":0,"plots":[]}`; string(buf) != want {
+		t.Errorf("marshaled empty snapshot = %s, want %s", buf, want)
+	}
+}
+
+func TestFrameSnapshot(t *testing.T) {
+	t.Parallel()
+
+	userPlots := []plot.UserPlot{
+		{Scatter: &plot.ScatterUserPlot{
+			Plot: plot.Scatter{
+				Name:     "user-scatter",
+				Subplots: []plot.Subplot{{Name: "a"}, {Name: "b"}},
+			},
+			Funcs: []func() float64{
+				func() float64 { return 1.5 },
+				func() float64 { return 2 },
+			},
+		}},
+		{Heatmap: plot.NewHeatmapUserPlot(
+			plot.Heatmap{Name: "user-heatmap"},
+			[]float64{0, 1, 2},
+			func() []uint64 { return []uint64{3, 4} },
+		)},
+	}
+
+	pl, err := plot.NewList(userPlots, time.Second, nil, plot.Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap := newFrame(pl.Collect(nil), pl.Config()).snapshot()
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Snapshot
+	if err := json.Unmarshal(buf, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot survives a round trip through JSON, with a millisecond
+	// precision.
+	if !snap.Time.Truncate(time.Millisecond).Equal(written.Time) {
+		t.Errorf("snapshot time = %v, want %v", snap.Time, written.Time)
+	}
+	snap.Time = written.Time
+	if !reflect.DeepEqual(snap, written) {
+		t.Errorf("snapshot = %+v\nwant %+v", snap, written)
+	}
+
+	plots := make(map[string]PlotSnapshot)
+	for _, p := range snap.Plots {
+		plots[p.Name] = p
+	}
+	want := PlotSnapshot{Name: "user-scatter", Subplots: []string{"a", "b"}, Values: []float64{1.5, 2}}
+	if got := plots["user-scatter"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("user-scatter = %+v, want %+v", got, want)
+	}
+	if got := plots["user-heatmap"]; !reflect.DeepEqual(got.Values, []float64{3, 4}) || len(got.Buckets) != 2 || got.Subplots != nil {
+		t.Errorf("user-heatmap = %+v, want 2 buckets with counts 3 and 4", got)
+	}
+}
+
+func TestServerPlots(t *testing.T) {
+	t.Parallel()
+
+	hp, err := HeatmapPlotConfig{
+		Name:     "latency",
+		Title:    "Latency",
+		Buckets:  []float64{0, 1},
+		Unit:     HeatmapUnitDuration,
+		GetValue: func() []uint64 { return []uint64{1, 2} },
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(t, HeatmapPlot(hp))
+	defer srv.Close()
+
+	plots := make(map[string]PlotInfo)
+	for _, p := range srv.Plots() {
+		plots[p.Name] = p
+	}
+	if p := plots["latency"]; !p.Heatmap || p.Title != "Latency" || p.Unit != HeatmapUnitDuration || p.Cumulative {
+		t.Errorf("latency = %+v, want a non cumulative heatmap of durations", p)
+	}
+	if p := plots["runnable-time"]; !p.Heatmap || !p.Cumulative {
+		t.Errorf("runnable-time = %+v, want a cumulative heatmap", p)
+	}
+	if p := plots["cgo"]; p.Heatmap || len(p.Unitfmts) != 1 {
+		t.Errorf("cgo = %+v, want a time series plot with 1 time series", p)
+	}
+}
@@ -38,17 +38,18 @@
 //	srv, err := statsviz.NewServer(); // Create server or handle error
 //	srv.Index()                       // UI (dashboard) http.HandlerFunc
 //	srv.Ws()                          // Websocket http.HandlerFunc
+//	srv.Export()                      // History export http.HandlerFunc
 package statsviz
 
 import (
-	"bytes"
+	"compress/flate"
 	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -60,6 +61,7 @@ import (
 const (
 	defaultRoot         = "/debug/statsviz"
 	defaultSendInterval = time.Second
+	defaultClientBuffer = 4
 )
 
 // RegisterDefault registers the Statsviz HTTP handlers on [http.DefaultServeMux].
@@ -88,18 +90,54 @@ func Register(mux *http.ServeMux, opts ...Option) error {
 //   - The Ws handler establishes a WebSocket connection allowing the connected
 //     browser to receive metrics updates from the server.
 //
+// Metrics are only collected while they're needed: when no user interface is
+// connected, collection is paused, unless history, recording, alerts, sinks,
+// snapshots or the metrics handler require it to be continuous.
+// Connected user interfaces tell the server which plots they show, so that the
+// others aren't collected.
+//
 // The zero value is a valid Server, with default options.
 //
-// NOTE: Having more than one Server in the same program is not supported (and
-// is not useful anyway).
+// A program can have multiple Servers, for example serving dashboards with
+// different plots on different listeners. They are independent from each
+// other, though Servers collecting metrics at the same time share the reading
+// of runtime metrics.
 type Server struct {
 	cancel  context.CancelFunc // terminate goroutines
 	clients *clients           // connected websocket clients
-
-	interval  time.Duration // interval between consecutive metrics emission
-	root      string        // HTTP path root
-	plots     *plot.List    // plots shown on the user interface
+	running tracker            // goroutines waited for by Shutdown
+
+	interval  time.Duration            // interval between consecutive metrics emission
+	intervals map[string]time.Duration // collection interval of some plots
+	root      string                   // HTTP path root
+	histsize  int                      // number of metrics messages kept for new clients
+	bufsize   int                      // number of metrics messages queued per client
+	plots     *plot.List               // plots shown on the user interface
 	userPlots []plot.UserPlot
+	selection plot.Selection // Statsviz plots shown, and their order
+	scraped   atomic.Bool    // the metrics are read outside of the user interface
+
+	authorizers []func(*http.Request) error // all must accept a request
+
+	upgrader       websocket.Upgrader
+	compress       bool                     // negotiate permessage-deflate
+	complevel      int                      // compress/flate compression level
+	allowedOrigins []string                 // origins allowed besides the server's
+	checkOrigin    func(*http.Request) bool // overrides the origin policy
+
+	sources []*aggsource // remote sources, when aggregating
+
+	alertRules []AlertRule
+	onAlert    func(AlertEvent)
+
+	streams     []plot.EventStream // user event streams
+	annotations annotator
+
+	sinks []Sink // receive the plots values at each collection
+
+	recname string    // file to record the session into
+	rec     *recorder // non-nil when recording
+	replay  *replayer // non-nil when replaying a recorded session
 }
 
 // NewServer constructs a new Statsviz Server with the provided options, or the
@@ -120,6 +158,7 @@ func (s *Server) init(opts ...Option) error {
 	*s = Server{
 		interval: defaultSendInterval,
 		root:     defaultRoot,
+		bufsize:  defaultClientBuffer,
 	}
 
 	for _, opt := range opts {
@@ -128,33 +167,162 @@ func (s *Server) init(opts ...Option) error {
 		}
 	}
 
-	pl, err := plot.NewList(s.userPlots)
-	if err != nil {
+	s.upgrader = websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   2048,
+		CheckOrigin:       s.originAllowed,
+		EnableCompression: s.compress,
+	}
+
+	if s.replay != nil {
+		if s.recname != "" {
+			return fmt.Errorf("can't record a replayed session")
+		}
+		if len(s.sources) > 0 {
+			return fmt.Errorf("can't aggregate remote sources when replaying a session")
+		}
+		if len(s.alertRules) > 0 {
+			return fmt.Errorf("can't evaluate alerts when replaying a session")
+		}
+		if len(s.streams) > 0 {
+			return fmt.Errorf("can't add event streams when replaying a session")
+		}
+		if len(s.sinks) > 0 {
+			return fmt.Errorf("can't add sinks when replaying a session")
+		}
+		if err := s.replay.check(); err != nil {
+			return err
+		}
+		s.replay.ctx, s.cancel = context.WithCancel(context.Background())
+		s.replay.running = &s.running
+		return nil
+	}
+
+	// Clients can ask for metrics in the packed format. Recorded sessions are
+	// replayed in JSON only.
+	s.upgrader.Subprotocols = []string{packedProtocol}
+
+	var (
+		src metricsSource
+		agg *aggregator
+		err error
+	)
+	if len(s.sources) > 0 {
+		if len(s.userPlots) > 0 {
+			return fmt.Errorf("user plots can't be added when aggregating remote sources")
+		}
+		if len(s.intervals) > 0 {
+			return fmt.Errorf("plot intervals can't be set when aggregating remote sources")
+		}
+		if s.selection.Include != nil || s.selection.Exclude != nil || s.selection.Order != nil {
+			return fmt.Errorf("plots can't be selected when aggregating remote sources")
+		}
+		if agg, err = newAggregator(s.sources); err != nil {
+			return err
+		}
+		src = agg
+	} else {
+		if s.plots, err = plot.NewList(s.userPlots, s.interval, s.intervals, s.selection); err != nil {
+			return err
+		}
+		src = s.plots
+	}
+
+	// Release the aggregator connections if initialization fails.
+	fail := func(err error) error {
+		if agg != nil {
+			agg.close()
+		}
 		return err
 	}
-	s.plots = pl
+
+	cfg := src.Config()
+	if len(s.streams) > 0 {
+		if cfg, err = withStreams(cfg, s.streams); err != nil {
+			return fail(err)
+		}
+	}
+
+	var alerts *alerter
+	if len(s.alertRules) > 0 {
+		if alerts, err = newAlerter(s.alertRules, s.onAlert, cfg); err != nil {
+			return fail(err)
+		}
+	}
+
+	if s.recname != "" {
+		if s.rec, err = newRecorder(s.recname); err != nil {
+			return fail(err)
+		}
+		if err := s.rec.writeConfig(cfg); err != nil {
+			s.rec.close()
+			return fail(err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	s.cancel = cancel
-	s.clients = newClients(ctx, s.plots.Config())
+	// Plots having their own collection interval might need to be collected
+	// more often.
+	interval := s.interval
+	if s.plots != nil {
+		interval = s.plots.Tick()
+	}
+
+	s.clients = newClients(ctx, cfg, s.histsize, interval, s.bufsize, &s.running)
+	if agg != nil {
+		agg.start(ctx)
+	}
 
 	// Collect metrics.
+	s.running.start()
 	go func() {
-		tick := time.NewTicker(s.interval)
+		tick := time.NewTicker(interval)
 		defer tick.Stop()
 		defer cancel()
+		defer func() { s.running.done(closeSinks(s.sinks)) }()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-tick.C:
-				buf := bytes.Buffer{}
-				if _, err := s.plots.WriteTo(&buf); err != nil {
-					dbglog("failed to collect metrics: %v", err)
-					return
+				plots, ok := s.wanted(alerts)
+				if !ok {
+					// Nobody needs metrics, pause until a client connects.
+					dbglog("pausing metrics collection")
+					tick.Stop()
+					for !ok {
+						select {
+						case <-ctx.Done():
+							return
+						case <-s.clients.wake:
+						}
+						plots, ok = s.wanted(alerts)
+					}
+					tick.Reset(interval)
+					dbglog("resuming metrics collection")
+				}
+
+				f := newFrame(src.Collect(plots), src.Config())
+				if s.rec != nil {
+					buf, err := f.json()
+					if err != nil {
+						dbglog("failed to collect metrics: %v", err)
+						return
+					}
+					if err := s.rec.write(buf); err != nil {
+						dbglog("failed to record metrics: %v", err)
+					}
+				}
+				s.clients.broadcast(f)
+				if len(s.sinks) > 0 {
+					writeSinks(s.sinks, f.snapshot())
+				}
+
+				if alerts != nil && alerts.eval(f.Frame) {
+					s.publishAlerts(alerts, f.Time)
 				}
-				s.clients.broadcast(buf.Bytes())
 			}
 		}
 	}()
@@ -162,21 +330,74 @@ func (s *Server) init(opts ...Option) error {
 	return nil
 }
 
+// wanted returns the plots to collect, nil meaning all of them. It returns
+// false if no metrics are needed at all: no client is connected and no
+// history, recording, alert, sink or metrics handler requires continuous
+// collection.
+func (s *Server) wanted(alerts *alerter) (plots map[string]bool, ok bool) {
+	if s.rec != nil || s.histsize > 0 || len(s.sinks) > 0 || s.scraped.Load() {
+		return nil, true
+	}
+
+	plots, n := s.clients.visible()
+	if n == 0 && alerts == nil {
+		return nil, false
+	}
+	if plots != nil && alerts != nil {
+		for _, rule := range alerts.rules {
+			plots[rule.Plot] = true
+		}
+	}
+	return plots, true
+}
+
+// publishAlerts sends the alert regions to all clients, and records them.
+func (s *Server) publishAlerts(a *alerter, now time.Time) {
+	msg, err := newJSONMsg("alerts", struct {
+		Alerts    []*alertRegion `json:"alerts"`
+		Timestamp int64          `json:"timestamp"`
+	}{a.regions, now.UnixMilli()})
+	if err != nil {
+		dbglog("failed to encode alerts: %v", err)
+		return
+	}
+	if s.rec != nil {
+		if err := s.rec.write(append(msg, '\n')); err != nil {
+			dbglog("failed to record alerts: %v", err)
+		}
+	}
+	s.clients.publish("alerts", msg)
+}
+
+// metricsSource provides the plots configuration and the metrics sent to
+// clients.
+type metricsSource interface {
+	Config() *plot.Config
+	Collect(plots map[string]bool) *plot.Frame
+}
+
 // Register registers the Statsviz HTTP handlers on the provided mux.
 //
 // Register must be called once per application.
 func (s *Server) Register(mux *http.ServeMux) {
-	if s.plots == nil {
+	if s.cancel == nil {
 		s.init()
 	}
 
 	mux.Handle(s.root+"/", s.Index())
 	mux.HandleFunc(s.root+"/ws", s.Ws())
+	mux.HandleFunc(s.root+"/export", s.Export())
 }
 
-// Close releases all resources used by the Server.
+// Close releases all resources used by the Server. If the session is being
+// recorded, the recording is flushed and closed. Websocket connections are
+// closed abruptly, use Shutdown to close them gracefully.
 func (s *Server) Close() error {
+	s.running.stop(false)
 	s.cancel()
+	if s.rec != nil {
+		return s.rec.close()
+	}
 	return nil
 }
 
@@ -195,6 +416,69 @@ func SendFrequency(intv time.Duration) Option {
 	}
 }
 
+// PlotInterval changes the interval between successive collections of the
+// named plot, which can be a Statsviz plot or a user plot. By default, plots
+// are collected at the interval set with [SendFrequency]. Metrics messages only
+// contain the plots that are due, so that cheap and frequently changing
+// metrics can be collected more often than expensive ones. This option can be
+// added multiple times.
+//
+// Metrics are collected at the shortest interval of all plots, so the other
+// intervals must be multiples of it, or [NewServer] returns an error. Setting
+// the interval of a plot that isn't shown, because of [IncludePlots] or
+// [ExcludePlots], is an error too. Some Statsviz heatmaps, like size-classes,
+// are collected every 5 default intervals.
+func PlotInterval(name string, intv time.Duration) Option {
+	return func(s *Server) error {
+		if intv <= 0 {
+			return fmt.Errorf("plot interval must be positive")
+		}
+		if s.intervals == nil {
+			s.intervals = make(map[string]time.Duration)
+		}
+		s.intervals[name] = intv
+		return nil
+	}
+}
+
+// IncludePlots restricts the Statsviz plots shown on the user interface to
+// the named ones. User plots are always shown. Metrics only used by plots that
+// aren't shown are never read. This option can be added multiple times.
+//
+// NewServer returns an error if a name doesn't match any Statsviz plot. Note
+// that the available plots depend on the Go version.
+func IncludePlots(names ...string) Option {
+	return func(s *Server) error {
+		s.selection.Include = append(s.selection.Include, names...)
+		return nil
+	}
+}
+
+// ExcludePlots removes the named Statsviz plots from the user interface.
+// Metrics only used by plots that aren't shown are never read. This option can
+// be added multiple times.
+//
+// NewServer returns an error if a name doesn't match any Statsviz plot. Note
+// that the available plots depend on the Go version.
+func ExcludePlots(names ...string) Option {
+	return func(s *Server) error {
+		s.selection.Exclude = append(s.selection.Exclude, names...)
+		return nil
+	}
+}
+
+// PlotOrder shows the named plots, which can be Statsviz plots or user plots,
+// first on the user interface, in the given order. Other plots follow in their
+// default order: Statsviz plots, then user plots. Ordering a plot that isn't
+// shown, because of [IncludePlots] or [ExcludePlots], is an error. This option
+// can be added multiple times.
+func PlotOrder(names ...string) Option {
+	return func(s *Server) error {
+		s.selection.Order = append(s.selection.Order, names...)
+		return nil
+	}
+}
+
 // Root changes the root path of the Statsviz user interface.
 // The default is "/debug/statsviz".
 func Root(path string) Option {
@@ -204,6 +488,87 @@ func Root(path string) Option {
 	}
 }
 
+// History sets the number of past metrics updates the server keeps in memory.
+// These are sent to newly connected clients right after the plots
+// configuration, so that the user interface immediately shows the recent past,
+// for example when opening the dashboard after an incident or reconnecting.
+// The default, 0, disables history.
+func History(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return fmt.Errorf("history size must be a non-negative integer")
+		}
+		s.histsize = n
+		return nil
+	}
+}
+
+// ClientBuffer sets the number of metrics messages queued for each client,
+// waiting to be sent. When a client, on a slow network for example, lags
+// behind and its queue is full, all queued messages are merged into a single
+// one holding the latest values, so that the client catches up as soon as
+// possible. The client is then told how many messages it missed. The default
+// is 4.
+//
+// Clients can also ask for less frequent updates, see the interval command in
+// the websocket protocol.
+func ClientBuffer(n int) Option {
+	return func(s *Server) error {
+		if n < 1 {
+			return fmt.Errorf("client buffer size must be a positive integer")
+		}
+		s.bufsize = n
+		return nil
+	}
+}
+
+// Compression enables the compression of websocket messages, with the
+// permessage-deflate extension (RFC 7692), for clients supporting it, as all
+// modern browsers do. Other clients receive uncompressed messages. level is a
+// compress/flate compression level, from [flate.HuffmanOnly] to
+// [flate.BestCompression], or [flate.DefaultCompression].
+//
+// Metrics messages, heatmaps in particular, are highly repetitive and compress
+// well. Compression reduces network usage at the cost of some CPU time in the
+// monitored program.
+func Compression(level int) Option {
+	return func(s *Server) error {
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			return fmt.Errorf("invalid compression level %d", level)
+		}
+		s.compress = true
+		s.complevel = level
+		return nil
+	}
+}
+
+// Record records the session into the named file, which is created or
+// truncated. The plots configuration and all metrics updates are written as
+// newline-delimited JSON, gzip-compressed if name ends with ".gz". The
+// recording is complete once [Server.Close] returns.
+//
+// Use [Replay], or the statsviz command, to visualize a recorded session.
+func Record(name string) Option {
+	return func(s *Server) error {
+		s.recname = name
+		return nil
+	}
+}
+
+// Replay configures the server to replay a session recorded with [Record],
+// rather than collecting runtime metrics. Each user interface connecting to
+// the server is sent the whole recording, from the start, at the original pace
+// multiplied by speed.
+func Replay(name string, speed float64) Option {
+	return func(s *Server) error {
+		if speed <= 0 {
+			return fmt.Errorf("replay speed must be positive")
+		}
+		s.replay = &replayer{name: name, speed: speed}
+		return nil
+	}
+}
+
 // TimeseriesPlot adds a new time series plot to Statsviz. This options can
 // be added multiple times.
 func TimeseriesPlot(tsp TimeSeriesPlot) Option {
@@ -213,13 +578,60 @@ func TimeseriesPlot(tsp TimeSeriesPlot) Option {
 	}
 }
 
+// HeatmapPlot adds a new heatmap plot to Statsviz. This options can be added
+// multiple times.
+func HeatmapPlot(hp Heatmap) Option {
+	return func(s *Server) error {
+		s.userPlots = append(s.userPlots, plot.UserPlot{Heatmap: hp.heatmap})
+		return nil
+	}
+}
+
 // Index returns the index handler, which responds with the Statsviz user
 // interface HTML page. By default, the handler is served at the path specified
 // by the root. Use [WithRoot] to change the path.
 func (s *Server) Index() http.HandlerFunc {
 	prefix := s.root + "/"
 	dist := http.FileServerFS(static.Assets())
-	return http.StripPrefix(prefix, dist).ServeHTTP
+	return s.authorized(http.StripPrefix(prefix, dist).ServeHTTP)
+}
+
+// Metrics returns a handler serving the values of all plots, user plots
+// included, in the Prometheus text exposition format, or in the OpenMetrics
+// format if requested by the client via the Accept header. Served values are
+// exactly those sent to the user interface at the last update: time series
+// plots are exposed as gauges and heatmaps as histograms, except heatmaps
+// showing the current state of a distribution, like size-classes, which are
+// gauge histograms in OpenMetrics and gauges with an 'le' label otherwise.
+//
+// The Metrics handler is not registered by [Server.Register], it's up to the
+// user to serve it at the desired path. Creating the handler keeps metrics
+// collection running when no user interface is connected.
+func (s *Server) Metrics() http.HandlerFunc {
+	s.keepCollecting()
+	return s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		if s.plots == nil {
+			http.Error(w, "metrics are only available for the current program", http.StatusNotFound)
+			return
+		}
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", plot.OpenMetricsFormat)
+		} else {
+			w.Header().Set("Content-Type", plot.PrometheusFormat)
+		}
+		if err := s.plots.WriteMetrics(w, openMetrics); err != nil {
+			dbglog("failed to write metrics: %v", err)
+		}
+	})
+}
+
+// keepCollecting keeps metrics collection running, even if no user interface
+// is connected.
+func (s *Server) keepCollecting() {
+	if s.clients != nil && !s.scraped.Swap(true) {
+		s.clients.wakeup()
+	}
 }
 
 func parseBoolEnv(name string) bool {
@@ -233,7 +645,8 @@ func parseBoolEnv(name string) bool {
 	return val
 }
 
-var debug = false
+// debug enables debug logs, and allows all websocket origins.
+var debug = parseBoolEnv("STATSVIZ_DEBUG")
 
 func dbglog(format string, args ...any) {
 	if debug {
@@ -241,34 +654,25 @@ func dbglog(format string, args ...any) {
 	}
 }
 
-var wsUpgrader = sync.OnceValue(func() websocket.Upgrader {
-	var checkOrigin func(r *http.Request) bool
-
-	// Allow all origins for testing.
-	if debug = parseBoolEnv("STATSVIZ_DEBUG"); debug {
-		// passthrough
-		checkOrigin = func(r *http.Request) bool { return true }
-	}
-
-	return websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 2048,
-		CheckOrigin:     checkOrigin,
-	}
-})
-
 // Ws returns the WebSocket handler used by Statsviz to send application
 // metrics. The underlying net.Conn is used to upgrade the HTTP server
 // connection to the WebSocket protocol.
 func (s *Server) Ws() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		upgrader := wsUpgrader()
-		ws, err := upgrader.Upgrade(w, r, nil)
+	return s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := s.upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			dbglog("failed to upgrade connection: %v", err)
 			return
 		}
+		if s.compress {
+			// The level has been validated, this can't fail.
+			_ = ws.SetCompressionLevel(s.complevel)
+		}
 
+		if s.replay != nil {
+			s.replay.serve(ws)
+			return
+		}
 		s.clients.add(ws)
-	}
+	})
 }
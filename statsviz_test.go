@@ -6,12 +6,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"github.com/arl/statsviz/internal/plot"
 	"github.com/arl/statsviz/internal/static"
 )
 
@@ -70,6 +75,113 @@ func TestRoot(t *testing.T) {
 	testIndex(t, newServer(t, Root("/test/")).Index(), "http://example.com/test/")
 }
 
+// TestAssetsUpToDate checks that the embedded dist.zip has been rebuilt from
+// the current sources: the served page must have all the elements of
+// index.html and the served script all the string literals of src/.
+func TestAssetsUpToDate(t *testing.T) {
+	t.Parallel()
+
+	get := func(h http.Handler, url string) string {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: http status %v, want %v", url, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	idx := newServer(t).Index()
+	html := get(idx, "http://example.com/debug/statsviz/")
+
+	src, err := os.ReadFile("internal/static/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range regexp.MustCompile(`id="[^"]+"`).FindAllString(string(src), -1) {
+		if !strings.Contains(html, m) {
+			t.Errorf("served index.html has no %s, dist.zip must be rebuilt", m)
+		}
+	}
+
+	m := regexp.MustCompile(`src="\./(assets/index-[^"]+\.js)"`).FindStringSubmatch(html)
+	if m == nil {
+		t.Fatal("served index.html has no script")
+	}
+	js := get(idx, "http://example.com/debug/statsviz/"+m[1])
+
+	files, err := filepath.Glob("internal/static/src/*.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no source files")
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, lit := range jsStrings(string(b)) {
+			if !strings.Contains(js, lit) {
+				t.Errorf("served script has no %q (from %s), dist.zip must be rebuilt", lit, filepath.Base(file))
+			}
+		}
+	}
+}
+
+// jsStrings returns the double-quoted string literals of the javascript
+// source src that a minifier leaves untouched: those with no escape sequence,
+// at least 4 characters long and that aren't module specifiers.
+func jsStrings(src string) []string {
+	var lits []string
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case strings.HasPrefix(src[i:], "//"):
+			i += strings.IndexByte(src[i:]+"\n", '\n')
+		case strings.HasPrefix(src[i:], "/*"):
+			i += strings.Index(src[i:]+"*/", "*/") + 1
+		case c == '/' && regexpAllowed(src[:i]):
+			// Skip the regular expression literal, which may have quotes.
+			class := false
+			for i++; i < len(src) && (class || src[i] != '/'); i++ {
+				switch src[i] {
+				case '\\':
+					i++
+				case '[':
+					class = true
+				case ']':
+					class = false
+				}
+			}
+		case c == '"' || c == '\'' || c == '`':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			lit := src[i+1 : min(j, len(src))]
+			before := strings.TrimSpace(src[:i])
+			module := strings.HasSuffix(before, "from") || strings.HasSuffix(before, "import")
+			if c == '"' && len(lit) >= 4 && !strings.Contains(lit, "\\") && !module {
+				lits = append(lits, lit)
+			}
+			i = j
+		}
+	}
+	return lits
+}
+
+// regexpAllowed reports whether a slash following the javascript source src
+// starts a regular expression literal rather than being a division.
+func regexpAllowed(src string) bool {
+	src = strings.TrimSpace(src)
+	return src == "" || strings.ContainsAny(src[len(src)-1:], "(,=:[!&|?{};>")
+}
+
 func testWs(t *testing.T, f http.Handler, URL string) {
 	t.Helper()
 
@@ -103,7 +215,7 @@ func testWs(t *testing.T, f http.Handler, URL string) {
 	}
 
 	// Check the content of 2 consecutive payloads.
-	for range 2 {
+	for i := range 2 {
 		// Verifies that we've received:
 		// - 1 time series (cgo)
 		// - 1 heatmap (sizeClasses).
@@ -126,7 +238,9 @@ func testWs(t *testing.T, f http.Handler, URL string) {
 			t.Errorf("len(cgo) = %d, want 1", len(msg.Data.Series.CGo))
 		}
 		// Heatmaps should have many elements, check that there's more than one.
-		if len(msg.Data.Series.SizeClasses) <= 1 {
+		// The size classes heatmap is collected less often than cgo, so it's
+		// only in the first payload, where all plots are.
+		if i == 0 && len(msg.Data.Series.SizeClasses) <= 1 {
 			t.Errorf("len(sizeClasses) = %d, want > 1", len(msg.Data.Series.SizeClasses))
 		}
 	}
@@ -234,3 +348,141 @@ func TestRegister(t *testing.T) {
 		}
 	})
 }
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, SendFrequency(10*time.Millisecond))
+	defer srv.Close()
+
+	get := func(accept string) *http.Response {
+		req := httptest.NewRequest("GET", "http://example.com/metrics", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		srv.Metrics()(w, req)
+		return w.Result()
+	}
+
+	// Wait for the first metrics collection.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		body, _ := io.ReadAll(get("").Body)
+		if bytes.Contains(body, []byte("# TYPE statsviz_goroutines gauge\n")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics not found in response body:\n%s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp := get("")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("header[Content-Type] = %s, want prometheus text format", ct)
+	}
+
+	resp = get("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/openmetrics-text; version=1.0.0; charset=utf-8" {
+		t.Errorf("header[Content-Type] = %s, want openmetrics format", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.HasSuffix(body, []byte("# EOF\n")) {
+		t.Errorf("openmetrics body doesn't end with # EOF:\n%s", body)
+	}
+}
+
+func TestMultipleServers(t *testing.T) {
+	t.Parallel()
+
+	tsp, err := TimeSeriesPlotConfig{
+		Name:   "tenant",
+		Series: []TimeSeries{{Name: "tenant", GetValue: func() float64 { return 1 }}},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srvA := newServer(t, Root("/a"), SendFrequency(10*time.Millisecond), TimeseriesPlot(tsp))
+	t.Cleanup(func() { srvA.Close() })
+	srvB := newServer(t, Root("/b"), SendFrequency(20*time.Millisecond), PlotInterval("cgo", 40*time.Millisecond))
+	t.Cleanup(func() { srvB.Close() })
+
+	type configMsg struct {
+		Data struct {
+			Series []struct {
+				Name     string `json:"name"`
+				Interval int64  `json:"interval"`
+			} `json:"series"`
+		} `json:"data"`
+	}
+
+	// Each server has its own plots and intervals, and sends metrics
+	// independently of the other.
+	check := func(t *testing.T, srv *Server, root string, want map[string]int64, wantTenant bool) {
+		mux := http.NewServeMux()
+		srv.Register(mux)
+		s := httptest.NewServer(mux)
+		defer s.Close()
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+root+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var cfg configMsg
+		if err := ws.ReadJSON(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		intervals := make(map[string]int64)
+		for _, s := range cfg.Data.Series {
+			intervals[s.Name] = s.Interval
+		}
+		if _, ok := intervals["tenant"]; ok != wantTenant {
+			t.Errorf("tenant plot shown = %t, want %t", ok, wantTenant)
+		}
+		for name, ms := range want {
+			if intervals[name] != ms {
+				t.Errorf("plot %s interval = %dms, want %dms", name, intervals[name], ms)
+			}
+		}
+
+		for range 5 {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("a", func(t *testing.T) {
+		t.Parallel()
+		check(t, srvA, "/a", map[string]int64{"cgo": 0}, true)
+	})
+	t.Run("b", func(t *testing.T) {
+		t.Parallel()
+		check(t, srvB, "/b", map[string]int64{"cgo": 40}, false)
+	})
+}
+
+func TestPlotSelection(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer(t, IncludePlots("cgo", "goroutines"), PlotOrder("goroutines"))
+	defer srv.Close()
+
+	var names []string
+	for _, layout := range srv.plots.Config().Series {
+		names = append(names, plot.LayoutName(layout))
+	}
+	if want := []string{"goroutines", "cgo"}; !slices.Equal(names, want) {
+		t.Errorf("plots = %v, want %v", names, want)
+	}
+
+	for _, opt := range []Option{IncludePlots("unknown"), ExcludePlots("unknown"), PlotOrder("unknown")} {
+		if _, err := NewServer(opt); err == nil {
+			t.Errorf("NewServer() should have errored")
+		}
+	}
+}
@@ -9,8 +9,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"testing/synctest"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -89,3 +93,284 @@ func TestWsConcurrent(t *testing.T) {
 		synctest.Wait()
 	})
 }
+
+// startSynctestServer starts an HTTP server serving h on a fake network
+// listener. It returns the websocket URL of the server and a dialer connecting
+// to it.
+func startSynctestServer(t *testing.T, h http.Handler) (string, *websocket.Dialer) {
+	t.Helper()
+
+	li := fakeNetListen()
+	s := &httptest.Server{
+		Listener: li,
+		Config:   &http.Server{Handler: h},
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Scheme = "ws"
+
+	dialer := &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return li.connect(), nil
+		},
+	}
+	return u.String(), dialer
+}
+
+type metricsMsg struct {
+	Event string `json:"event"`
+	Data  struct {
+		Timestamp int64 `json:"timestamp"`
+	} `json:"data"`
+}
+
+func TestWsHistory(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		const histsize = 5
+
+		srv := newServer(t, History(histsize), SendFrequency(time.Second))
+		defer srv.Close()
+
+		u, dialer := startSynctestServer(t, srv.Ws())
+
+		// Let the server collect more metrics than the history can hold.
+		time.Sleep(2*histsize*time.Second + time.Second/2)
+		connected := time.Now()
+
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var cfg map[string]any
+		if err := ws.ReadJSON(&cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		// The first messages are the history, from the oldest to the newest.
+		var prev int64
+		for i := range histsize {
+			var msg metricsMsg
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			ts := msg.Data.Timestamp
+			if ts >= connected.UnixMilli() {
+				t.Fatalf("history message %d has timestamp %d, want < %d", i, ts, connected.UnixMilli())
+			}
+			if ts <= prev {
+				t.Fatalf("history message %d has timestamp %d, want > %d", i, ts, prev)
+			}
+			prev = ts
+		}
+		if want := connected.Add(-time.Second / 2).UnixMilli(); prev != want {
+			t.Errorf("last history message has timestamp %d, want %d", prev, want)
+		}
+
+		// Then come the live updates.
+		var msg metricsMsg
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Data.Timestamp <= connected.UnixMilli() {
+			t.Errorf("live message has timestamp %d, want > %d", msg.Data.Timestamp, connected.UnixMilli())
+		}
+	})
+}
+
+func TestWsSlowClient(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		srv := newServer(t, SendFrequency(time.Second), ClientBuffer(2))
+		defer srv.Close()
+
+		li := fakeNetListen()
+		s := &httptest.Server{Listener: li, Config: &http.Server{Handler: srv.Ws()}}
+		s.Start()
+		defer s.Close()
+		u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+		var conn *fakeNetConn
+		dialer := websocket.Dialer{
+			NetDialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				conn = li.connect()
+				return conn, nil
+			},
+		}
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var cfg map[string]any
+		if err := ws.ReadJSON(&cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		// Don't read for a while, with a small buffer the server can't keep
+		// on sending.
+		conn.SetReadBufferSize(512)
+		time.Sleep(10 * time.Second)
+
+		for range 10 {
+			var msg struct {
+				Event string `json:"event"`
+				Data  struct {
+					Frames int `json:"frames"`
+				} `json:"data"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Event == "dropped" {
+				if msg.Data.Frames == 0 {
+					t.Errorf("dropped event with 0 frames")
+				}
+				return
+			}
+		}
+		t.Errorf("no dropped event received")
+	})
+}
+
+func TestReplayPace(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "session.ndjson")
+	rec := `{"event":"config","data":{"series":[],"events":[]}}
+{"event":"metrics","data":{"series":{},"timestamp":1700000000000}}
+{"event":"metrics","data":{"series":{},"timestamp":1700000001000}}
+{"event":"metrics","data":{"series":{},"timestamp":1700000003000}}
+`
+	if err := os.WriteFile(name, []byte(rec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		srv := newServer(t, Replay(name, 2))
+		defer srv.Close()
+
+		u, dialer := startSynctestServer(t, srv.Ws())
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var cfg wsmsg
+		if err := ws.ReadJSON(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Event != "config" {
+			t.Fatalf("first message is %q, want config", cfg.Event)
+		}
+
+		start := time.Now()
+		for _, want := range []time.Duration{0, 500 * time.Millisecond, 1500 * time.Millisecond} {
+			var msg metricsMsg
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if got := time.Since(start); got != want {
+				t.Errorf("message with timestamp %d received after %v, want %v", msg.Data.Timestamp, got, want)
+			}
+		}
+	})
+}
+
+func TestWsShutdown(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		srv := newServer(t, SendFrequency(time.Second))
+
+		u, dialer := startSynctestServer(t, srv.Ws())
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		// The client reads until the server closes the connection.
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					closed <- err
+					return
+				}
+			}
+		}()
+		time.Sleep(3 * time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		start := time.Now()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown() = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= closeTimeout {
+			t.Errorf("Shutdown took %v, the client acknowledged the close frame", elapsed)
+		}
+
+		err = <-closed
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("client got %v, want a going away close frame", err)
+		}
+		if _, n := srv.clients.visible(); n != 0 {
+			t.Errorf("%d clients still registered after shutdown", n)
+		}
+
+		// New clients are told right away that the server went away.
+		ws2, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws2.Close()
+		if _, _, err := ws2.ReadMessage(); err != nil { // config
+			t.Fatal(err)
+		}
+		if _, _, err := ws2.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("new client got %v, want a going away close frame", err)
+		}
+	})
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		srv := newServer(t)
+
+		u, dialer := startSynctestServer(t, srv.Ws())
+		ws, _, err := dialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		synctest.Wait()
+
+		// The client never reads, so it doesn't acknowledge the close frame.
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout/2)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+		}
+		// The connection is closed anyway after a while.
+		time.Sleep(closeTimeout)
+		synctest.Wait()
+		if _, n := srv.clients.visible(); n != 0 {
+			t.Errorf("%d clients still registered", n)
+		}
+	})
+}
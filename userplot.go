@@ -3,6 +3,9 @@ package statsviz
 import (
 	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/arl/statsviz/internal/plot"
 )
@@ -43,8 +46,34 @@ var (
 
 	// ErrEmptyPlotName is returned when a user plot has an empty name.
 	ErrEmptyPlotName = errors.New("user plot name can't be empty")
+
+	// ErrInvalidBuckets is returned when the bucket boundaries of a heatmap
+	// plot are invalid.
+	ErrInvalidBuckets = errors.New("heatmap plot buckets must be at least 2 increasing boundaries (4 if the last one is +Inf)")
+
+	// ErrNilGetValue is returned when a heatmap plot has no GetValue function.
+	ErrNilGetValue = errors.New("heatmap plot GetValue function can't be nil")
+
+	// ErrInvalidInterval is returned when the collection interval of a user
+	// plot is negative.
+	ErrInvalidInterval = errors.New("user plot interval can't be negative")
+
+	// ErrEmptyPlotTag is returned when a user plot has an empty tag.
+	ErrEmptyPlotTag = errors.New("user plot tags can't be empty")
 )
 
+// plotTags validates the tags of a user plot, and returns them or, if there
+// are none, the default tag.
+func plotTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return []string{"misc"}, nil
+	}
+	if slices.Contains(tags, "") {
+		return nil, ErrEmptyPlotTag
+	}
+	return slices.Clone(tags), nil
+}
+
 // ErrReservedPlotName is returned when a reserved plot name is used for a user plot.
 type ErrReservedPlotName string
 
@@ -117,6 +146,17 @@ type TimeSeriesPlotConfig struct {
 	// Series contains the time series shown on this plot, there must be at
 	// least one.
 	Series []TimeSeries
+
+	// Interval is the interval between successive collections of the plot
+	// values. As with [PlotInterval], it must be a multiple of the shortest
+	// interval of all plots. default: the interval set with [SendFrequency].
+	Interval time.Duration
+
+	// Tags are the categories of the plot, each of which gets a toggle on
+	// the user interface to show or hide its plots. Statsviz plots have the
+	// "cpu", "gc", "scheduler" and "misc" tags, but any other tag can be
+	// used. default: "misc".
+	Tags []string
 }
 
 // Build validates the configuration and builds a time series plot for it
@@ -131,6 +171,13 @@ func (p TimeSeriesPlotConfig) Build() (TimeSeriesPlot, error) {
 	if len(p.Series) == 0 {
 		return zero, ErrNoTimeSeries
 	}
+	if p.Interval < 0 {
+		return zero, ErrInvalidInterval
+	}
+	tags, err := plotTags(p.Tags)
+	if err != nil {
+		return zero, err
+	}
 
 	var (
 		subplots []plot.Subplot
@@ -159,6 +206,7 @@ func (p TimeSeriesPlotConfig) Build() (TimeSeriesPlot, error) {
 		timeseries: &plot.ScatterUserPlot{
 			Plot: plot.Scatter{
 				Name:     p.Name,
+				Tags:     tags,
 				Title:    p.Title,
 				Type:     string(p.Type),
 				InfoText: p.InfoText,
@@ -171,7 +219,8 @@ func (p TimeSeriesPlotConfig) Build() (TimeSeriesPlot, error) {
 				},
 				Subplots: subplots,
 			},
-			Funcs: funcs,
+			Funcs:    funcs,
+			Interval: p.Interval,
 		},
 	}, nil
 }
@@ -181,3 +230,137 @@ func (p TimeSeriesPlotConfig) Build() (TimeSeriesPlot, error) {
 type TimeSeriesPlot struct {
 	timeseries *plot.ScatterUserPlot
 }
+
+// HeatmapUnit describes the unit of the buckets of a heatmap plot.
+type HeatmapUnit string
+
+const (
+	// HeatmapUnitDuration indicates bucket boundaries are durations, expressed
+	// in seconds.
+	HeatmapUnitDuration HeatmapUnit = "duration"
+
+	// HeatmapUnitBytes indicates bucket boundaries are sizes, in bytes.
+	HeatmapUnitBytes HeatmapUnit = "bytes"
+)
+
+// HeatmapPlotConfig describes the configuration of a heatmap plot. A heatmap
+// plot shows how a distribution, represented by an histogram, evolves over
+// time. For example the distribution of HTTP request durations.
+type HeatmapPlotConfig struct {
+	// Name is the plot name, it must be unique.
+	Name string
+
+	// Title is the plot title, shown above the plot.
+	Title string
+
+	// InfoText is the html-aware text shown when the user clicks on the plot
+	// Info icon.
+	InfoText string
+
+	// YAxisTitle is the title of Y axis.
+	YAxisTitle string
+
+	// Buckets contains the histogram bucket boundaries, in increasing order.
+	// As for [metrics.Float64Histogram], bucket i contains the values in the
+	// range [Buckets[i], Buckets[i+1]). The first and last boundaries can be
+	// -Inf and +Inf. Histograms with many buckets are downsampled before being
+	// shown.
+	Buckets []float64
+
+	// Unit is the unit of bucket boundaries, either [HeatmapUnitDuration],
+	// [HeatmapUnitBytes] or any other string, which is then shown as suffix of
+	// the bucket boundaries.
+	Unit HeatmapUnit
+
+	// BucketName is the name given to buckets in the user interface, for
+	// example "duration".
+	BucketName string
+
+	// CountName is the name given to bucket counts in the user interface, for
+	// example "requests".
+	CountName string
+
+	// GetValue specifies the function called to get the histogram counts. It
+	// must return len(Buckets)-1 counts, the count at index i being that of
+	// bucket i. Missing counts are considered to be zero and extra ones are
+	// ignored.
+	GetValue func() []uint64
+
+	// Interval is the interval between successive collections of the plot
+	// values, see [TimeSeriesPlotConfig.Interval]. default: the interval set
+	// with [SendFrequency].
+	Interval time.Duration
+
+	// Tags are the categories of the plot, see [TimeSeriesPlotConfig.Tags].
+	// default: "misc".
+	Tags []string
+}
+
+// Build validates the configuration and builds a heatmap plot for it.
+func (p HeatmapPlotConfig) Build() (Heatmap, error) {
+	var zero Heatmap
+	if p.Name == "" {
+		return zero, ErrEmptyPlotName
+	}
+	if plot.IsReservedPlotName(p.Name) {
+		return zero, ErrReservedPlotName(p.Name)
+	}
+	if !validBuckets(p.Buckets) {
+		return zero, ErrInvalidBuckets
+	}
+	if p.GetValue == nil {
+		return zero, ErrNilGetValue
+	}
+	if p.Interval < 0 {
+		return zero, ErrInvalidInterval
+	}
+	tags, err := plotTags(p.Tags)
+	if err != nil {
+		return zero, err
+	}
+
+	layout := plot.Heatmap{
+		Name:       p.Name,
+		Tags:       tags,
+		Title:      p.Title,
+		InfoText:   p.InfoText,
+		Colorscale: plot.BlueShades,
+		Hover: plot.HeapmapHover{
+			YName: p.BucketName,
+			YUnit: string(p.Unit),
+			ZName: p.CountName,
+		},
+		Layout: plot.HeatmapLayout{
+			YAxis: plot.HeatmapYaxis{
+				Title: p.YAxisTitle,
+			},
+		},
+	}
+
+	hp := plot.NewHeatmapUserPlot(layout, p.Buckets, p.GetValue)
+	hp.Interval = p.Interval
+	return Heatmap{heatmap: hp}, nil
+}
+
+func validBuckets(buckets []float64) bool {
+	if len(buckets) < 2 {
+		return false
+	}
+	// Plotly doesn't support an infinite upper bound so we need enough
+	// buckets to extrapolate the width of the last one.
+	if math.IsInf(buckets[len(buckets)-1], 1) && len(buckets) < 4 {
+		return false
+	}
+	for i := 1; i < len(buckets); i++ {
+		if !(buckets[i] > buckets[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Heatmap is an opaque type representing a heatmap plot.
+// A plot can be created with [HeatmapPlotConfig.Build].
+type Heatmap struct {
+	heatmap *plot.HeatmapUserPlot
+}
@@ -2,7 +2,10 @@ package statsviz
 
 import (
 	"errors"
+	"math"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestTimeSeriesPlotConfigErrors(t *testing.T) {
@@ -25,4 +28,89 @@ func TestTimeSeriesPlotConfigErrors(t *testing.T) {
 			t.Errorf("Build() returned err = %v, want %v", err, ErrEmptyPlotName)
 		}
 	})
+	t.Run("negative interval", func(t *testing.T) {
+		tsb := TimeSeriesPlotConfig{
+			Name:     "some name",
+			Series:   []TimeSeries{{Name: "a", GetValue: func() float64 { return 0 }}},
+			Interval: -time.Second,
+		}
+		if _, err := tsb.Build(); !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("Build() returned err = %v, want %v", err, ErrInvalidInterval)
+		}
+	})
+	t.Run("empty tag", func(t *testing.T) {
+		tsb := TimeSeriesPlotConfig{
+			Name:   "some name",
+			Series: []TimeSeries{{Name: "a", GetValue: func() float64 { return 0 }}},
+			Tags:   []string{"http", ""},
+		}
+		if _, err := tsb.Build(); !errors.Is(err, ErrEmptyPlotTag) {
+			t.Errorf("Build() returned err = %v, want %v", err, ErrEmptyPlotTag)
+		}
+	})
+}
+
+func TestUserPlotTags(t *testing.T) {
+	tsp, err := TimeSeriesPlotConfig{
+		Name:   "requests",
+		Series: []TimeSeries{{Name: "a", GetValue: func() float64 { return 0 }}},
+		Tags:   []string{"http", "db"},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := tsp.timeseries.Plot.Tags; !slices.Equal(tags, []string{"http", "db"}) {
+		t.Errorf("time series plot tags = %v, want [http db]", tags)
+	}
+
+	hp, err := HeatmapPlotConfig{
+		Name:     "latency",
+		Buckets:  []float64{0, 1, 2},
+		GetValue: func() []uint64 { return nil },
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := hp.heatmap.Plot.Tags; !slices.Equal(tags, []string{"misc"}) {
+		t.Errorf("heatmap plot tags = %v, want the default [misc]", tags)
+	}
+}
+
+func TestHeatmapPlotConfigErrors(t *testing.T) {
+	t.Run("empty name", func(t *testing.T) {
+		hb := HeatmapPlotConfig{}
+		if _, err := hb.Build(); !errors.Is(err, ErrEmptyPlotName) {
+			t.Errorf("Build() returned err = %v, want %v", err, ErrEmptyPlotName)
+		}
+	})
+	t.Run("reserved name", func(t *testing.T) {
+		hb := HeatmapPlotConfig{Name: "lastgc"}
+		var target ErrReservedPlotName
+		if _, err := hb.Build(); !errors.As(err, &target) {
+			t.Errorf("Build() returned err = %v, want %v", err, target)
+		}
+	})
+
+	invalid := map[string][]float64{
+		"no buckets":     nil,
+		"single bound":   {1},
+		"not increasing": {1, 3, 2},
+		"duplicate":      {1, 2, 2, 3},
+		"NaN":            {1, math.NaN(), 3},
+		"few with +Inf":  {1, 2, math.Inf(1)},
+	}
+	for name, buckets := range invalid {
+		t.Run(name, func(t *testing.T) {
+			hb := HeatmapPlotConfig{Name: "some name", Buckets: buckets}
+			if _, err := hb.Build(); !errors.Is(err, ErrInvalidBuckets) {
+				t.Errorf("Build() returned err = %v, want %v", err, ErrInvalidBuckets)
+			}
+		})
+	}
+	t.Run("nil GetValue", func(t *testing.T) {
+		hb := HeatmapPlotConfig{Name: "some name", Buckets: []float64{0, 1, 2}}
+		if _, err := hb.Build(); !errors.Is(err, ErrNilGetValue) {
+			t.Errorf("Build() returned err = %v, want %v", err, ErrNilGetValue)
+		}
+	})
 }